@@ -0,0 +1,434 @@
+// Command loadtest drives a running server over WebSocket and reports how
+// many frames and wire bytes the clients received, plus client and server
+// CPU time. Run it twice, with and without -compress/-batch, to compare.
+//
+// The users in [-first-user, -first-user+-users) must already be members of
+// -room, or exist and be subscribed with -subscribe when -room is a public
+// channel; tokens are minted locally with -secret.
+//
+//	go run ./cmd/loadtest -room 1 -users 200 -rate 50 -server-pid $(pidof im-server)
+//	go run ./cmd/loadtest -room 1 -users 200 -rate 50 -compress -batch -server-pid ...
+//
+// The broadcast scenario has the first -senders users (the channel's owner
+// and admins) post to a broadcast channel and reports delivery latency
+// across the audience. 10k connections need a matching ulimit -n on both
+// sides:
+//
+//	go run ./cmd/loadtest -scenario broadcast -room 7 -users 10000 -senders 1 -rate 2 -subscribe
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"chat-backend/pkg/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+type options struct {
+	addr      string
+	secret    string
+	room      uint
+	firstUser uint
+	users     int
+	senders   int
+	rate      int
+	duration  time.Duration
+	compress  bool
+	batch     bool
+	serverPID int
+	scenario  string
+	subscribe bool
+}
+
+// A scenario sends traffic from the sender connections until ctx is done.
+type scenario func(ctx context.Context, o options, senders []*websocket.Conn)
+
+var scenarios = map[string]scenario{
+	"typing":    typingScenario,
+	"broadcast": broadcastScenario,
+}
+
+// Delivery latencies in 1ms buckets; the last one collects the rest
+const latencyBuckets = 10000
+
+type stats struct {
+	frames   atomic.Int64
+	payload  atomic.Int64
+	wire     atomic.Int64
+	failures atomic.Int64
+	latency  [latencyBuckets]atomic.Int64
+}
+
+func main() {
+	var o options
+	var room, firstUser uint64
+	flag.StringVar(&o.addr, "addr", "localhost:8081", "server host:port")
+	flag.StringVar(&o.secret, "secret", "your-secret-key", "jwt.secret of the server")
+	flag.Uint64Var(&room, "room", 1, "room to load")
+	flag.Uint64Var(&firstUser, "first-user", 1, "first user id")
+	flag.IntVar(&o.users, "users", 100, "number of connected users")
+	flag.IntVar(&o.senders, "senders", 10, "users that generate traffic")
+	flag.IntVar(&o.rate, "rate", 20, "frames per second per sender")
+	flag.DurationVar(&o.duration, "duration", 30*time.Second, "test duration")
+	flag.BoolVar(&o.compress, "compress", false, "negotiate permessage-deflate")
+	flag.BoolVar(&o.batch, "batch", false, "opt into frame batching")
+	flag.IntVar(&o.serverPID, "server-pid", 0, "server pid, for server CPU time")
+	flag.StringVar(&o.scenario, "scenario", "typing", "traffic scenario: typing or broadcast")
+	flag.BoolVar(&o.subscribe, "subscribe", false, "join -room as a public channel before connecting")
+	flag.Parse()
+	o.room, o.firstUser = uint(room), uint(firstUser)
+
+	run, ok := scenarios[o.scenario]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown scenario %q\n", o.scenario)
+		os.Exit(2)
+	}
+	if o.senders > o.users {
+		o.senders = o.users
+	}
+
+	if o.subscribe {
+		if err := subscribe(o); err != nil {
+			fmt.Fprintf(os.Stderr, "subscribe: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var st stats
+	conns := make([]*websocket.Conn, 0, o.users)
+	for i := 0; i < o.users; i++ {
+		conn, err := dial(o, o.firstUser+uint(i), &st)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "connect user %d: %v\n", o.firstUser+uint(i), err)
+			os.Exit(1)
+		}
+		conns = append(conns, conn)
+	}
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			read(conn, &st)
+		}(conn)
+	}
+
+	// Ignore the welcome frames in the numbers
+	time.Sleep(time.Second)
+	st.frames.Store(0)
+	st.payload.Store(0)
+	st.wire.Store(0)
+	for i := range st.latency {
+		st.latency[i].Store(0)
+	}
+
+	clientCPU := processCPU()
+	serverCPU := serverCPUTime(o.serverPID)
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.duration)
+	run(ctx, o, conns[:o.senders])
+	cancel()
+
+	// Let queued frames drain before measuring
+	time.Sleep(time.Second)
+	elapsed := time.Since(start)
+	clientCPU = processCPU() - clientCPU
+	if o.serverPID != 0 {
+		serverCPU = serverCPUTime(o.serverPID) - serverCPU
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	wg.Wait()
+
+	frames, payload, wire := st.frames.Load(), st.payload.Load(), st.wire.Load()
+	fmt.Printf("scenario:    %s (compress=%v batch=%v)\n", o.scenario, o.compress, o.batch)
+	fmt.Printf("clients:     %d (%d senders at %d/s) for %s\n", o.users, o.senders, o.rate, elapsed.Round(time.Millisecond))
+	fmt.Printf("frames:      %d received (%.0f/s), %d failed\n", frames, float64(frames)/elapsed.Seconds(), st.failures.Load())
+	fmt.Printf("payload:     %d bytes\n", payload)
+	if payload > 0 {
+		fmt.Printf("wire:        %d bytes (%.1f%% of payload)\n", wire, float64(wire)*100/float64(payload))
+	}
+	if p50, p99, max, n := latencies(&st); n > 0 {
+		fmt.Printf("latency:     p50 %s, p99 %s, max %s over %d deliveries\n", p50, p99, max, n)
+	}
+	fmt.Printf("client cpu:  %s\n", clientCPU.Round(time.Millisecond))
+	if o.serverPID != 0 {
+		fmt.Printf("server cpu:  %s\n", serverCPU.Round(time.Millisecond))
+	}
+}
+
+func dial(o options, userID uint, st *stats) (*websocket.Conn, error) {
+	token, err := utils.GenerateToken(userID, "loadtest", o.secret)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("user_id", strconv.FormatUint(uint64(userID), 10))
+	q.Set("token", token)
+	if o.batch {
+		q.Set("batch", "1")
+	}
+	u := url.URL{Scheme: "ws", Host: o.addr, Path: "/ws", RawQuery: q.Encode()}
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  10 * time.Second,
+		EnableCompression: o.compress,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &countingConn{Conn: conn, n: &st.wire}, nil
+		},
+	}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	return conn, err
+}
+
+// read counts every logical frame, unpacking batch frames.
+func read(conn *websocket.Conn, st *stats) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		st.payload.Add(int64(len(data)))
+		recordLatencies(data, st)
+
+		var frame struct {
+			Type string            `json:"type"`
+			Data []json.RawMessage `json:"data"`
+		}
+		if strings.HasPrefix(string(data), `{"type":"batch"`) && json.Unmarshal(data, &frame) == nil {
+			st.frames.Add(int64(len(frame.Data)))
+			continue
+		}
+		if strings.HasPrefix(string(data), `{"type":"error"`) {
+			st.failures.Add(1)
+		}
+		st.frames.Add(1)
+	}
+}
+
+func typingScenario(ctx context.Context, o options, senders []*websocket.Conn) {
+	var wg sync.WaitGroup
+	for _, conn := range senders {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Second / time.Duration(o.rate))
+			defer ticker.Stop()
+			typing := true
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					frame, _ := json.Marshal(map[string]interface{}{
+						"type":    "typing",
+						"room_id": o.room,
+						"data":    map[string]interface{}{"is_typing": typing},
+					})
+					typing = !typing
+					if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+						return
+					}
+				}
+			}
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// broadcastScenario posts messages stamped with their send time, which
+// read turns into delivery latencies.
+func broadcastScenario(ctx context.Context, o options, senders []*websocket.Conn) {
+	var wg sync.WaitGroup
+	for _, conn := range senders {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Second / time.Duration(o.rate))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					frame, _ := json.Marshal(map[string]interface{}{
+						"type":    "message",
+						"room_id": o.room,
+						"content": fmt.Sprintf("%s%d", sentAtPrefix, time.Now().UnixNano()),
+					})
+					if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+						return
+					}
+				}
+			}
+		}(conn)
+	}
+	wg.Wait()
+}
+
+const sentAtPrefix = "loadtest-sent-at:"
+
+// recordLatencies finds the send stamps of the messages in a frame
+func recordLatencies(data []byte, st *stats) {
+	s := string(data)
+	now := time.Now().UnixNano()
+	for {
+		i := strings.Index(s, sentAtPrefix)
+		if i < 0 {
+			return
+		}
+		s = s[i+len(sentAtPrefix):]
+		end := 0
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		sentAt, err := strconv.ParseInt(s[:end], 10, 64)
+		s = s[end:]
+		if err != nil {
+			continue
+		}
+		bucket := (now - sentAt) / int64(time.Millisecond)
+		if bucket < 0 {
+			bucket = 0
+		} else if bucket >= latencyBuckets {
+			bucket = latencyBuckets - 1
+		}
+		st.latency[bucket].Add(1)
+	}
+}
+
+func latencies(st *stats) (p50, p99, max time.Duration, n int64) {
+	for i := range st.latency {
+		n += st.latency[i].Load()
+	}
+	if n == 0 {
+		return
+	}
+	var seen int64
+	for i := range st.latency {
+		c := st.latency[i].Load()
+		if c == 0 {
+			continue
+		}
+		seen += c
+		d := time.Duration(i+1) * time.Millisecond
+		if p50 == 0 && seen*2 >= n {
+			p50 = d
+		}
+		if p99 == 0 && seen*100 >= n*99 {
+			p99 = d
+		}
+		max = d
+	}
+	return
+}
+
+// subscribe joins every user to -room through the channel API
+func subscribe(o options) error {
+	ids := make(chan uint)
+	errs := make(chan error, o.users)
+	var wg sync.WaitGroup
+	for w := 0; w < 32; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				if err := join(o, id); err != nil {
+					errs <- fmt.Errorf("user %d: %w", id, err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < o.users; i++ {
+		ids <- o.firstUser + uint(i)
+	}
+	close(ids)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func join(o options, userID uint) error {
+	token, err := utils.GenerateToken(userID, "loadtest", o.secret)
+	if err != nil {
+		return err
+	}
+	u := url.URL{Scheme: "http", Host: o.addr, Path: fmt.Sprintf("/api/channels/%d/join", o.room)}
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("join answered %s", resp.Status)
+	}
+	return nil
+}
+
+// countingConn counts bytes read off the socket, i.e. after compression.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func processCPU() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// serverCPUTime reads utime+stime of pid from /proc (Linux only).
+func serverCPUTime(pid int) time.Duration {
+	if pid == 0 {
+		return 0
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// Fields after the parenthesised command name start at state (field 3)
+	s := string(data)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 13 {
+		return 0
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	// USER_HZ is 100 on every Linux target we run on
+	return time.Duration(utime+stime) * (time.Second / 100)
+}
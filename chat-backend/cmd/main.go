@@ -2,14 +2,22 @@ package main
 
 import (
 	"chat-backend/cmd/wire"
+	"chat-backend/internal/domain/audit"
 	"chat-backend/internal/domain/chat"
 	"chat-backend/internal/domain/market"
+	"chat-backend/internal/domain/moderation"
 	"chat-backend/internal/domain/room"
 	"chat-backend/internal/domain/user"
 	"chat-backend/pkg/logger"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
@@ -48,8 +56,23 @@ func main() {
 		port = "8081"
 	}
 	logger.L.Info("IM Combined Server starting", zap.String("port", port))
-	if err := application.Engine.Run(":" + port); err != nil {
-		logger.L.Fatal("failed to start server", zap.Error(err))
+	srv := &http.Server{Addr: ":" + port, Handler: application.Engine}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.L.Fatal("failed to start server", zap.Error(err))
+		}
+	}()
+
+	// 7. Shut down on SIGINT/SIGTERM so deferred cleanups run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	logger.L.Info("IM Combined Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.L.Error("failed to shut down server", zap.Error(err))
 	}
 }
 
@@ -134,11 +157,26 @@ func initDB() *gorm.DB {
 		&user.FriendGroup{},
 		&room.Room{},
 		&room.RoomMember{},
+		&room.Invite{},
+		&room.JoinRequest{},
+		&room.Invitation{},
+		&room.Ban{},
+		&room.Announcement{},
 		&chat.Message{},
 		&chat.ReadReceipt{},
 		&market.MarketPrice{},
+		&moderation.Review{},
+		&audit.Log{},
 	); err != nil {
 		logger.L.Warn("Auto migration warning", zap.Error(err))
 	}
+
+	// Group creators from before roles existed become owners
+	if err := db.Exec(`UPDATE room_members SET role = ? WHERE role = ? AND EXISTS (
+		SELECT 1 FROM rooms WHERE rooms.id = room_members.room_id
+		AND rooms.creator_id = room_members.user_id AND rooms.type = ?)`,
+		room.RoleOwner, room.RoleMember, room.RoomTypeGroup).Error; err != nil {
+		logger.L.Warn("failed to backfill room owners", zap.Error(err))
+	}
 	return db
 }
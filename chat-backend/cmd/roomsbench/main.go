@@ -0,0 +1,334 @@
+// Command roomsbench measures the conversation list (GET /api/rooms) for a
+// user in many rooms. It seeds a user into -rooms groups with -messages
+// messages each, then times the old per-room queries against the
+// Redis-backed summaries, with cold (keys dropped) and warm caches, and
+// counts the SQL statements and Redis round trips of one list.
+//
+// It connects with the server's ./configs/config.yaml; seeded rows are
+// removed afterwards unless -keep is given.
+//
+//	go run ./cmd/roomsbench -rooms 500 -messages 20 -runs 10
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
+	"chat-backend/internal/infrastructure/persistence"
+	"chat-backend/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type options struct {
+	rooms    int
+	members  int
+	messages int
+	runs     int
+	keep     bool
+}
+
+type counters struct {
+	sql   atomic.Int64
+	redis atomic.Int64
+}
+
+func main() {
+	var o options
+	flag.IntVar(&o.rooms, "rooms", 500, "groups the user belongs to")
+	flag.IntVar(&o.members, "members", 5, "members per group, including the user")
+	flag.IntVar(&o.messages, "messages", 20, "messages per group")
+	flag.IntVar(&o.runs, "runs", 10, "timed lists per variant")
+	flag.BoolVar(&o.keep, "keep", false, "keep the seeded data")
+	flag.Parse()
+	if o.members < 2 {
+		o.members = 2
+	}
+
+	logger.L = zap.NewNop()
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath("./configs")
+	if err := viper.ReadInConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "read config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cnt counters
+	db, rdb, err := connect(&cnt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("seeding %d rooms x %d members x %d messages...\n", o.rooms, o.members, o.messages)
+	s, err := seed(db, o)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		os.Exit(1)
+	}
+	if !o.keep {
+		defer s.cleanup(db, rdb)
+	}
+
+	roomRepo := persistence.NewRoomRepository(db, rdb, room.DefaultLimits())
+	messageRepo := persistence.NewMessageRepository(db, rdb)
+
+	list := func() error {
+		rooms, err := roomRepo.GetByUserID(s.userID, false)
+		if err != nil {
+			return err
+		}
+		ids := make([]uint, len(rooms))
+		for i := range rooms {
+			ids[i] = rooms[i].ID
+		}
+		_, err = messageRepo.Summaries(s.userID, ids, nil)
+		return err
+	}
+	legacy := func() error {
+		rooms, err := roomRepo.GetByUserID(s.userID, false)
+		if err != nil {
+			return err
+		}
+		for i := range rooms {
+			legacySummary(db, rooms[i].ID, s.userID)
+		}
+		return nil
+	}
+	dropKeys := func() error {
+		return s.dropKeys(rdb)
+	}
+
+	fmt.Println()
+	report("legacy per-room", &cnt, o.runs, nil, legacy)
+	report("summaries, cold", &cnt, o.runs, dropKeys, list)
+	report("summaries, warm", &cnt, o.runs, nil, list)
+}
+
+func connect(cnt *counters) (*gorm.DB, *redis.Client, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		viper.GetString("db.user"), viper.GetString("db.password"),
+		viper.GetString("db.host"), viper.GetString("db.port"), viper.GetString("db.name"),
+	)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		return nil, nil, err
+	}
+	count := func(*gorm.DB) { cnt.sql.Add(1) }
+	db.Callback().Query().After("gorm:query").Register("roomsbench:count", count)
+	db.Callback().Row().After("gorm:row").Register("roomsbench:count", count)
+	db.Callback().Raw().After("gorm:raw").Register("roomsbench:count", count)
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", viper.GetString("redis.host"), viper.GetString("redis.port")),
+		Password: viper.GetString("redis.password"),
+		DB:       viper.GetInt("redis.db"),
+	})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, nil, err
+	}
+	rdb.AddHook(redisCounter{cnt})
+	return db, rdb, nil
+}
+
+// redisCounter counts round trips; a pipeline or script counts as one
+type redisCounter struct{ cnt *counters }
+
+func (h redisCounter) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h redisCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.cnt.redis.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h redisCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.cnt.redis.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+// legacySummary reproduces the queries the list handler used to run for
+// every room: read receipts, unread count, last message and its sender.
+func legacySummary(db *gorm.DB, roomID uint, userID uint) {
+	var readReceipts []chat.ReadReceipt
+	db.Table("read_receipts").Where("room_id = ?", roomID).Find(&readReceipts)
+
+	var lastReadID uint
+	for _, r := range readReceipts {
+		if r.UserID == userID {
+			lastReadID = r.LastReadMessageID
+			break
+		}
+	}
+	var count int64
+	db.Table("messages").
+		Where("room_id = ? AND sender_id != ? AND id > ?", roomID, userID, lastReadID).
+		Count(&count)
+
+	var lastMsg struct {
+		ID        uint
+		Content   string
+		Format    chat.TextFormat
+		PlainText string
+		CreatedAt time.Time
+		SenderID  uint
+		Sender    struct {
+			Username string
+			Nickname string
+		} `gorm:"-"`
+	}
+	if err := db.Table("messages").
+		Where("room_id = ?", roomID).
+		Order("created_at DESC").
+		First(&lastMsg).Error; err == nil {
+		db.Table("users").Select("username, nickname").Where("id = ?", lastMsg.SenderID).First(&lastMsg.Sender)
+	}
+}
+
+func report(name string, cnt *counters, runs int, before func() error, fn func() error) {
+	durations := make([]time.Duration, 0, runs)
+	var sqlTotal, redisTotal int64
+	for i := 0; i < runs; i++ {
+		if before != nil {
+			if err := before(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				os.Exit(1)
+			}
+		}
+		sqlStart, redisStart := cnt.sql.Load(), cnt.redis.Load()
+		start := time.Now()
+		if err := fn(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+		durations = append(durations, time.Since(start))
+		sqlTotal += cnt.sql.Load() - sqlStart
+		redisTotal += cnt.redis.Load() - redisStart
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	fmt.Printf("%-18s p50 %-10s max %-10s %4d sql  %3d redis per list\n", name,
+		durations[len(durations)/2].Round(time.Microsecond),
+		durations[len(durations)-1].Round(time.Microsecond),
+		sqlTotal/int64(runs), redisTotal/int64(runs))
+}
+
+type seeded struct {
+	userID  uint
+	userIDs []uint
+	roomIDs []uint
+}
+
+func seed(db *gorm.DB, o options) (*seeded, error) {
+	s := &seeded{}
+	tag := time.Now().UnixNano()
+	users := make([]user.User, o.members)
+	for i := range users {
+		name := fmt.Sprintf("bench%d_%d", tag, i)
+		users[i] = user.User{Username: name, Nickname: name, Email: name + "@bench.invalid", Password: "-"}
+	}
+	if err := db.Create(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		s.userIDs = append(s.userIDs, u.ID)
+	}
+	s.userID = s.userIDs[0]
+
+	rooms := make([]room.Room, o.rooms)
+	for i := range rooms {
+		rooms[i] = room.Room{Name: fmt.Sprintf("bench room %d", i), Type: room.RoomTypeGroup, CreatorID: s.userID}
+	}
+	if err := db.Omit("Members", "Memberships", "Announcement").CreateInBatches(&rooms, 500).Error; err != nil {
+		return s, err
+	}
+
+	now := time.Now()
+	var memberships []room.RoomMember
+	var messages []chat.Message
+	for i, rm := range rooms {
+		s.roomIDs = append(s.roomIDs, rm.ID)
+		for j, uid := range s.userIDs {
+			role := room.RoleMember
+			if j == 0 {
+				role = room.RoleOwner
+			}
+			memberships = append(memberships, room.RoomMember{RoomID: rm.ID, UserID: uid, Role: role, JoinedAt: now})
+		}
+		for k := 0; k < o.messages; k++ {
+			messages = append(messages, chat.Message{
+				RoomID:   rm.ID,
+				SenderID: s.userIDs[(i+k)%len(s.userIDs)],
+				Content:  fmt.Sprintf("message %d", k),
+				Format:   chat.TextFormatPlain,
+				Type:     chat.MessageTypeText,
+			})
+		}
+	}
+	if err := db.CreateInBatches(&memberships, 1000).Error; err != nil {
+		return s, err
+	}
+	if err := db.CreateInBatches(&messages, 1000).Error; err != nil {
+		return s, err
+	}
+
+	// Every member has read half of each room
+	var receipts []chat.ReadReceipt
+	for i := 0; i < len(messages); i += o.messages {
+		if o.messages == 0 {
+			break
+		}
+		mid := messages[i+o.messages/2]
+		for _, uid := range s.userIDs {
+			receipts = append(receipts, chat.ReadReceipt{RoomID: mid.RoomID, UserID: uid, LastReadMessageID: mid.ID, ReadAt: now})
+		}
+	}
+	if len(receipts) > 0 {
+		if err := db.CreateInBatches(&receipts, 1000).Error; err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (s *seeded) dropKeys(rdb *redis.Client) error {
+	keys := []string{fmt.Sprintf("unread:%d", s.userID)}
+	for _, id := range s.roomIDs {
+		keys = append(keys, fmt.Sprintf("room:%d:last", id))
+	}
+	return rdb.Del(context.Background(), keys...).Err()
+}
+
+func (s *seeded) cleanup(db *gorm.DB, rdb *redis.Client) {
+	s.dropKeys(rdb)
+	if len(s.roomIDs) > 0 {
+		db.Where("room_id IN ?", s.roomIDs).Delete(&chat.ReadReceipt{})
+		db.Unscoped().Where("room_id IN ?", s.roomIDs).Delete(&chat.Message{})
+		db.Where("room_id IN ?", s.roomIDs).Delete(&room.RoomMember{})
+		db.Unscoped().Where("id IN ?", s.roomIDs).Delete(&room.Room{})
+	}
+	if len(s.userIDs) > 0 {
+		db.Unscoped().Where("id IN ?", s.userIDs).Delete(&user.User{})
+	}
+}
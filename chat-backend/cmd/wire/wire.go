@@ -17,20 +17,36 @@ import (
 
 func InitializeApp(db *gorm.DB, rdb *redis.Client) (*app.App, func(), error) {
 	wire.Build(
+		command.LoadRoomLimits,
 		persistence.NewUserRepository,
 		persistence.NewRoomRepository,
 		persistence.NewMessageRepository,
 		persistence.NewMarketRepository,
+		persistence.NewModerationRepository,
+		persistence.NewAuditRepository,
+		persistence.NewInviteRepository,
+		persistence.NewJoinRequestRepository,
+		persistence.NewInvitationRepository,
+		persistence.NewBanRepository,
+		command.NewModerationHandler,
+		command.NewAuthzHandler,
+		command.NewSystemMessageHandler,
 		command.NewAuthHandler,
 		command.NewUserHandler,
 		command.NewRoomHandler,
 		command.NewMessageHandler,
 		command.NewMarketHandler,
+		command.NewImportHandler,
+		command.NewInviteHandler,
+		command.NewJoinRequestHandler,
 		http.NewAuthHandler,
 		http.NewUserHandler,
 		http.NewRoomHandler,
 		http.NewMessageHandler,
 		http.NewMarketHandler,
+		http.NewImportHandler,
+		http.NewInviteHandler,
+		http.NewJoinRequestHandler,
 		ws.NewHub,
 		http.NewRouter,
 		wire.Struct(new(http.RouterOptions), "*"),
@@ -22,28 +22,51 @@ func InitializeApp(db *gorm.DB, rdb *redis.Client) (*app.App, func(), error) {
 	repository := persistence.NewUserRepository(db, rdb)
 	authHandler := command.NewAuthHandler(repository)
 	httpAuthHandler := http.NewAuthHandler(authHandler)
-	userHandler := command.NewUserHandler(repository)
+	moderationRepository := persistence.NewModerationRepository(db)
+	moderationHandler, cleanup, err := command.NewModerationHandler(moderationRepository)
+	if err != nil {
+		return nil, nil, err
+	}
+	userHandler := command.NewUserHandler(repository, moderationHandler)
 	httpUserHandler := http.NewUserHandler(userHandler)
-	roomRepository := persistence.NewRoomRepository(db, rdb)
-	roomHandler := command.NewRoomHandler(roomRepository)
-	chatRepository := persistence.NewMessageRepository(db)
-	hub := ws.NewHub(chatRepository, roomRepository, repository, rdb)
-	httpRoomHandler := http.NewRoomHandler(roomHandler, db, hub)
-	messageHandler := command.NewMessageHandler(chatRepository)
+	limits := command.LoadRoomLimits()
+	roomRepository := persistence.NewRoomRepository(db, rdb, limits)
+	auditRepository := persistence.NewAuditRepository(db)
+	banRepository := persistence.NewBanRepository(db)
+	authzHandler := command.NewAuthzHandler(roomRepository, auditRepository, banRepository, limits)
+	chatRepository := persistence.NewMessageRepository(db, rdb)
+	invitationRepository := persistence.NewInvitationRepository(db)
+	systemMessageHandler := command.NewSystemMessageHandler(chatRepository, repository)
+	roomHandler := command.NewRoomHandler(roomRepository, repository, chatRepository, invitationRepository, banRepository, moderationHandler, authzHandler, systemMessageHandler)
+	hub := ws.NewHub(chatRepository, roomRepository, repository, rdb, moderationHandler, authzHandler, limits)
+	httpRoomHandler := http.NewRoomHandler(roomHandler, hub)
+	messageHandler := command.NewMessageHandler(chatRepository, authzHandler)
 	httpMessageHandler := http.NewMessageHandler(messageHandler, hub)
 	marketRepository := persistence.NewMarketRepository(db)
 	marketHandler := command.NewMarketHandler(marketRepository)
 	httpMarketHandler := http.NewMarketHandler(marketHandler)
+	importHandler := command.NewImportHandler(repository, roomRepository, chatRepository, invitationRepository, moderationHandler)
+	httpImportHandler := http.NewImportHandler(importHandler, hub)
+	inviteRepository := persistence.NewInviteRepository(db)
+	joinRequestRepository := persistence.NewJoinRequestRepository(db)
+	joinRequestHandler := command.NewJoinRequestHandler(joinRequestRepository, roomRepository, authzHandler, systemMessageHandler)
+	inviteHandler := command.NewInviteHandler(inviteRepository, roomRepository, authzHandler, joinRequestHandler, systemMessageHandler)
+	httpInviteHandler := http.NewInviteHandler(inviteHandler, hub)
+	httpJoinRequestHandler := http.NewJoinRequestHandler(joinRequestHandler, hub)
 	routerOptions := http.RouterOptions{
-		AuthHandler:    httpAuthHandler,
-		UserHandler:    httpUserHandler,
-		RoomHandler:    httpRoomHandler,
-		MessageHandler: httpMessageHandler,
-		MarketHandler:  httpMarketHandler,
-		Hub:            hub,
+		AuthHandler:        httpAuthHandler,
+		UserHandler:        httpUserHandler,
+		RoomHandler:        httpRoomHandler,
+		MessageHandler:     httpMessageHandler,
+		MarketHandler:      httpMarketHandler,
+		ImportHandler:      httpImportHandler,
+		InviteHandler:      httpInviteHandler,
+		JoinRequestHandler: httpJoinRequestHandler,
+		Hub:                hub,
 	}
 	engine := http.NewRouter(routerOptions)
 	appApp := app.NewApp(engine, hub)
 	return appApp, func() {
+		cleanup()
 	}, nil
 }
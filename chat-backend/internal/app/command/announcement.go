@@ -0,0 +1,95 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/moderation"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"time"
+	"unicode/utf8"
+)
+
+const maxAnnouncementLength = 5000
+
+// SetAnnouncement publishes or edits a group's announcement. Editing resets
+// every member's acknowledgement.
+func (h *RoomHandler) SetAnnouncement(roomID uint, operatorID uint, content string, format chat.TextFormat) (*room.Room, error) {
+	if content == "" {
+		return nil, xerror.New(xerror.CodeInvalidParams, "announcement cannot be empty")
+	}
+	if utf8.RuneCountInString(content) > maxAnnouncementLength {
+		return nil, xerror.New(xerror.CodeInvalidParams, "announcement must be at most 5000 characters")
+	}
+	rm, err := h.announcementGroup(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	screened, err := h.moderation.Screen(content)
+	if err != nil {
+		return nil, err
+	}
+	a := &room.Announcement{
+		RoomID:   roomID,
+		AuthorID: operatorID,
+		Content:  screened.Text,
+		Format:   format,
+	}
+	if err := a.Render(); err != nil {
+		return nil, err
+	}
+	if err := h.roomRepo.SetAnnouncement(a); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to save announcement")
+	}
+	h.moderation.Flag(screened, operatorID, moderation.TargetAnnouncement, rm.ID)
+	return h.roomRepo.GetByID(roomID)
+}
+
+func (h *RoomHandler) ClearAnnouncement(roomID uint, operatorID uint) error {
+	rm, err := h.announcementGroup(roomID, operatorID)
+	if err != nil {
+		return err
+	}
+	if rm.Announcement == nil {
+		return xerror.New(xerror.CodeNotFound, "room has no announcement")
+	}
+	if err := h.roomRepo.DeleteAnnouncement(roomID); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to remove announcement")
+	}
+	return nil
+}
+
+// AcknowledgeAnnouncement marks the current announcement as seen by userID.
+func (h *RoomHandler) AcknowledgeAnnouncement(roomID uint, userID uint) error {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) == "" {
+		return xerror.New(xerror.CodePermissionDenied, "you are not a member of this room")
+	}
+	if rm.Announcement == nil {
+		return xerror.New(xerror.CodeNotFound, "room has no announcement")
+	}
+	if err := h.roomRepo.AcknowledgeAnnouncement(roomID, userID, time.Now()); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to acknowledge announcement")
+	}
+	return nil
+}
+
+func (h *RoomHandler) announcementGroup(roomID uint, operatorID uint) (*room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, xerror.New(xerror.CodeInvalidParams, "announcements are only available for group rooms")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermEditInfo); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+)
+
+const (
+	defaultChannelPageSize = 20
+	maxChannelPageSize     = 50
+)
+
+// ListChannels searches the public channels, broadcast ones included, marking those userID has
+// already joined.
+func (h *RoomHandler) ListChannels(userID uint, query string, limit int, offset int) ([]room.ChannelInfo, error) {
+	if limit <= 0 {
+		limit = defaultChannelPageSize
+	} else if limit > maxChannelPageSize {
+		limit = maxChannelPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	channels, err := h.roomRepo.SearchChannels(query, limit, offset)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to list channels")
+	}
+	for i := range channels {
+		channels[i].Joined, _ = h.roomRepo.IsMember(channels[i].ID, userID)
+	}
+	return channels, nil
+}
+
+// JoinChannel adds userID to a public channel without an invite. Joining a channel
+// the user is already in is a no-op; a channel with JoinApproval set takes
+// a join request instead (JoinRequestHandler.Request).
+func (h *RoomHandler) JoinChannel(roomID uint, userID uint) (*room.Room, []chat.Message, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil || !rm.Type.IsPublic() {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "channel not found")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) != "" {
+		return rm, nil, nil
+	}
+	if err := h.authz.RequireNotBanned(userID, roomID); err != nil {
+		return nil, nil, err
+	}
+	if rm.JoinApproval {
+		return nil, nil, xerror.New(xerror.CodePermissionDenied, "this channel requires approval to join, send a join request")
+	}
+	if err := h.authz.RequireCapacity(rm, 1); err != nil {
+		return nil, nil, err
+	}
+
+	if err := h.roomRepo.AddMember(roomID, userID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to join channel")
+	}
+	rm, err = h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to join channel")
+	}
+	if rm.Type == room.RoomTypeBroadcast {
+		// Subscribers come and go without notice
+		return rm, nil, nil
+	}
+	return rm, h.system.MemberJoined(roomID, userID), nil
+}
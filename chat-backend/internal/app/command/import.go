@@ -0,0 +1,621 @@
+package command
+
+import (
+	"archive/zip"
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/moderation"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/sensitive"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type ImportFormat string
+
+const (
+	// ImportFormatGoChat is the go-chat JSON export: a single export.json
+	// (optionally zipped together with the uploads/ it references).
+	ImportFormatGoChat ImportFormat = "gochat"
+	// ImportFormatSlack is a Slack workspace export zip: users.json plus one
+	// directory of daily JSON files per channel.
+	ImportFormatSlack ImportFormat = "slack"
+)
+
+const (
+	importUploadDir   = "uploads"
+	maxImportJSONSize = 64 * 1024 * 1024
+	maxImportFileSize = 4 * 1024 * 1024
+)
+
+type ImportOptions struct {
+	Format   ImportFormat
+	RoomName string
+	// Channel selects the channel directory of a Slack export. It may be
+	// omitted when the export contains a single channel.
+	Channel string
+}
+
+type ImportResult struct {
+	Room          *room.Room `json:"-"`
+	Imported      int        `json:"imported"`
+	Skipped       int        `json:"skipped"`
+	Files         int        `json:"files"`
+	MissingFiles  int        `json:"missing_files"`
+	UnmappedUsers []string   `json:"unmapped_users"`
+	// Invitations go to the local accounts matched to export authors; they
+	// join only if they accept.
+	Invitations []room.Invitation `json:"invitations"`
+}
+
+// importableTypes are the message types an archive may contain; anything
+// else, system messages in particular, is skipped.
+var importableTypes = map[chat.MessageType]bool{
+	chat.MessageTypeText:  true,
+	chat.MessageTypeImage: true,
+	chat.MessageTypeFile:  true,
+}
+
+// importedUser is an author from the source system, identified by Key
+// (the source user id) and matched locally by username, then email.
+type importedUser struct {
+	Key      string
+	Username string
+	Email    string
+	Name     string
+}
+
+type importedMessage struct {
+	SenderKey string
+	Content   string
+	Type      chat.MessageType
+	CreatedAt time.Time
+	FilePath  string // attachment location inside the archive
+	FileName  string
+	FileSize  int64
+}
+
+type importSource struct {
+	Name     string
+	Avatar   string
+	Users    []importedUser
+	Messages []importedMessage
+}
+
+type ImportHandler struct {
+	userRepo       user.Repository
+	roomRepo       room.Repository
+	messageRepo    chat.Repository
+	invitationRepo room.InvitationRepository
+	moderation     *ModerationHandler
+	// importers may import history; back-dated rooms are an operator tool
+	importers map[uint]bool
+}
+
+func NewImportHandler(userRepo user.Repository, roomRepo room.Repository, messageRepo chat.Repository, invitationRepo room.InvitationRepository, moderation *ModerationHandler) *ImportHandler {
+	importers := make(map[uint]bool)
+	for _, id := range viper.GetIntSlice("import.admin_ids") {
+		if id > 0 {
+			importers[uint(id)] = true
+		}
+	}
+	return &ImportHandler{
+		userRepo:       userRepo,
+		roomRepo:       roomRepo,
+		messageRepo:    messageRepo,
+		invitationRepo: invitationRepo,
+		moderation:     moderation,
+		importers:      importers,
+	}
+}
+
+// Import reads an export archive and replays it into a new group room owned
+// by importerID. filename decides whether r is a bare JSON document or a zip.
+//
+// Only the operators listed in import.admin_ids may import. Messages by
+// authors matching local accounts are attributed to them, and those accounts
+// are invited, not added; the rest are posted by the importer with the
+// original author's name as text. Names and messages go through the same
+// screening and rendering as regular sends.
+func (h *ImportHandler) Import(importerID uint, r io.ReaderAt, size int64, filename string, opts ImportOptions) (*ImportResult, error) {
+	if !h.importers[importerID] {
+		return nil, xerror.New(xerror.CodePermissionDenied, "importing history is restricted to operators")
+	}
+
+	var (
+		src *importSource
+		zr  *zip.Reader
+		err error
+	)
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		if opts.Format != ImportFormatGoChat {
+			return nil, xerror.New(xerror.CodeInvalidParams, "slack exports must be uploaded as a zip archive")
+		}
+		src, err = parseGoChatExport(io.NewSectionReader(r, 0, size))
+	} else {
+		zr, err = zip.NewReader(r, size)
+		if err != nil {
+			return nil, xerror.New(xerror.CodeInvalidParams, "invalid zip archive")
+		}
+		switch opts.Format {
+		case ImportFormatGoChat:
+			src, err = parseGoChatArchive(zr)
+		case ImportFormatSlack:
+			src, err = parseSlackArchive(zr, opts.Channel)
+		default:
+			err = xerror.New(xerror.CodeInvalidParams, "unsupported import format")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RoomName != "" {
+		src.Name = opts.RoomName
+	}
+	if src.Name == "" {
+		src.Name = "Imported history"
+	}
+	screened, err := h.moderation.Screen(src.Name)
+	if err != nil {
+		return nil, err
+	}
+	src.Name = screened.Text
+
+	return h.replay(importerID, src, zr)
+}
+
+func (h *ImportHandler) replay(importerID uint, src *importSource, zr *zip.Reader) (*ImportResult, error) {
+	result := &ImportResult{UnmappedUsers: []string{}, Invitations: []room.Invitation{}}
+
+	// Resolve source authors to local accounts
+	userIDs := make(map[string]uint, len(src.Users))
+	names := make(map[string]string, len(src.Users))
+	for _, iu := range src.Users {
+		names[iu.Key] = iu.Name
+		if id, ok := h.matchUser(iu); ok {
+			userIDs[iu.Key] = id
+			continue
+		}
+		result.UnmappedUsers = append(result.UnmappedUsers, iu.Name)
+	}
+
+	rm := &room.Room{
+		Name:      src.Name,
+		Avatar:    src.Avatar,
+		Type:      room.RoomTypeGroup,
+		CreatorID: importerID,
+	}
+	if err := h.roomRepo.Create(rm); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to create room")
+	}
+	if err := h.roomRepo.AddMember(rm.ID, importerID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to add creator to room")
+	}
+	if err := h.roomRepo.SetRole(rm.ID, importerID, room.RoleOwner); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to add creator to room")
+	}
+	invited := map[uint]bool{importerID: true}
+	for _, id := range userIDs {
+		if invited[id] {
+			continue
+		}
+		invited[id] = true
+		invitation := room.Invitation{
+			RoomID:    rm.ID,
+			InviterID: importerID,
+			InviteeID: id,
+			Status:    room.InvitationPending,
+		}
+		if err := h.invitationRepo.Create(&invitation); err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to invite imported members")
+		}
+		result.Invitations = append(result.Invitations, invitation)
+	}
+
+	sort.SliceStable(src.Messages, func(i, j int) bool {
+		return src.Messages[i].CreatedAt.Before(src.Messages[j].CreatedAt)
+	})
+
+	copied := make(map[string]string)
+	messages := make([]chat.Message, 0, len(src.Messages))
+	screens := make([]sensitive.Result, 0, len(src.Messages))
+	for _, im := range src.Messages {
+		m := chat.Message{
+			RoomID:    rm.ID,
+			SenderID:  importerID,
+			Content:   im.Content,
+			Type:      im.Type,
+			CreatedAt: im.CreatedAt,
+			UpdatedAt: im.CreatedAt,
+		}
+		if m.Type == "" {
+			m.Type = chat.MessageTypeText
+		}
+		if !importableTypes[m.Type] {
+			result.Skipped++
+			continue
+		}
+
+		// Matched authors keep their messages; unmapped ones are kept as
+		// text. Mentions are dropped so an import cannot notify anyone.
+		if id, ok := userIDs[im.SenderKey]; ok {
+			m.SenderID = id
+		} else if m.Content != "" {
+			name := names[im.SenderKey]
+			if name == "" {
+				name = im.SenderKey
+			}
+			m.Content = fmt.Sprintf("[%s] %s", name, m.Content)
+		}
+
+		if im.FilePath != "" {
+			url, ok := copied[im.FilePath]
+			if !ok {
+				var err error
+				url, err = copyArchiveFile(zr, im.FilePath)
+				if err != nil {
+					url = ""
+				}
+				copied[im.FilePath] = url
+				if url != "" {
+					result.Files++
+				}
+			}
+			if url == "" {
+				result.MissingFiles++
+				m.Type = chat.MessageTypeText
+				if m.Content == "" {
+					m.Content = im.FileName
+				}
+			} else {
+				m.FileURL = url
+				m.FileName = im.FileName
+				m.FileSize = im.FileSize
+			}
+		}
+
+		if m.Content == "" && m.FileURL == "" {
+			result.Skipped++
+			continue
+		}
+
+		// Blocked or malformed messages are skipped like on a regular send
+		screened, err := h.moderation.Screen(m.Content)
+		if err != nil {
+			result.Skipped++
+			continue
+		}
+		m.Content = screened.Text
+		if err := m.Render(); err != nil {
+			result.Skipped++
+			continue
+		}
+		messages = append(messages, m)
+		screens = append(screens, screened)
+	}
+
+	if err := h.messageRepo.CreateBatch(messages); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to import messages")
+	}
+	result.Imported = len(messages)
+	for i := range messages {
+		h.moderation.Flag(screens[i], messages[i].SenderID, moderation.TargetMessage, messages[i].ID)
+	}
+
+	saved, err := h.roomRepo.GetByID(rm.ID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load imported room")
+	}
+	result.Room = saved
+	return result, nil
+}
+
+func (h *ImportHandler) matchUser(iu importedUser) (uint, bool) {
+	if iu.Username != "" {
+		if u, err := h.userRepo.GetByUsername(iu.Username); err == nil {
+			return u.ID, true
+		}
+	}
+	if iu.Email != "" {
+		if u, err := h.userRepo.GetByEmail(iu.Email); err == nil {
+			return u.ID, true
+		}
+	}
+	return 0, false
+}
+
+// copyArchiveFile stores an archived attachment under uploads/ using the same
+// naming scheme as regular uploads and returns its public URL.
+func copyArchiveFile(zr *zip.Reader, name string) (string, error) {
+	if zr == nil {
+		return "", os.ErrNotExist
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(importUploadDir); os.IsNotExist(err) {
+		os.MkdirAll(importUploadDir, 0755)
+	}
+
+	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), path.Base(name))
+	out, err := os.Create(filepath.Join(importUploadDir, filename))
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(f, maxImportFileSize+1))
+	if err == nil && n > maxImportFileSize {
+		err = fmt.Errorf("attachment %s exceeds size limit", name)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(filepath.Join(importUploadDir, filename))
+		return "", err
+	}
+	return fmt.Sprintf("/uploads/%s", filename), nil
+}
+
+func readArchiveJSON(zr *zip.Reader, name string, v interface{}) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(io.LimitReader(f, maxImportJSONSize)).Decode(v)
+}
+
+// go-chat export
+
+type goChatExport struct {
+	Room struct {
+		Name   string `json:"name"`
+		Avatar string `json:"avatar"`
+	} `json:"room"`
+	Members  []user.UserResponse    `json:"members"`
+	Messages []chat.MessageResponse `json:"messages"`
+}
+
+func parseGoChatArchive(zr *zip.Reader) (*importSource, error) {
+	f, err := zr.Open("export.json")
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInvalidParams, "archive does not contain export.json")
+	}
+	defer f.Close()
+	return parseGoChatExport(f)
+}
+
+func parseGoChatExport(r io.Reader) (*importSource, error) {
+	var export goChatExport
+	if err := json.NewDecoder(io.LimitReader(r, maxImportJSONSize)).Decode(&export); err != nil {
+		return nil, xerror.New(xerror.CodeInvalidParams, "invalid export document")
+	}
+
+	src := &importSource{
+		Name:   export.Room.Name,
+		Avatar: export.Room.Avatar,
+	}
+
+	seen := make(map[string]bool)
+	addUser := func(u user.UserResponse) {
+		key := strconv.FormatUint(uint64(u.ID), 10)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		name := u.Nickname
+		if name == "" {
+			name = u.Username
+		}
+		src.Users = append(src.Users, importedUser{
+			Key:      key,
+			Username: u.Username,
+			Email:    u.Email,
+			Name:     name,
+		})
+	}
+	for _, u := range export.Members {
+		addUser(u)
+	}
+
+	for _, m := range export.Messages {
+		addUser(m.Sender)
+		im := importedMessage{
+			SenderKey: strconv.FormatUint(uint64(m.Sender.ID), 10),
+			Content:   m.Content,
+			Type:      m.Type,
+			CreatedAt: m.CreatedAt,
+			FileName:  m.FileName,
+			FileSize:  m.FileSize,
+		}
+		if strings.HasPrefix(m.FileURL, "/uploads/") {
+			im.FilePath = strings.TrimPrefix(m.FileURL, "/")
+		}
+		src.Messages = append(src.Messages, im)
+	}
+	return src, nil
+}
+
+// Slack export
+
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
+	} `json:"profile"`
+}
+
+type slackMessage struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	User    string `json:"user"`
+	Text    string `json:"text"`
+	Ts      string `json:"ts"`
+	Files   []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Mimetype string `json:"mimetype"`
+		Size     int64  `json:"size"`
+	} `json:"files"`
+}
+
+var (
+	slackMentionPattern = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+	slackLinkPattern    = regexp.MustCompile(`<((?:https?|mailto):[^|>]+)(?:\|([^>]+))?>`)
+	slackHTMLEntities   = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+// Slack subtypes that only describe channel bookkeeping and carry no content
+// worth preserving.
+var slackSkippedSubtypes = map[string]bool{
+	"channel_join":    true,
+	"channel_leave":   true,
+	"channel_topic":   true,
+	"channel_purpose": true,
+	"channel_name":    true,
+}
+
+func parseSlackArchive(zr *zip.Reader, channel string) (*importSource, error) {
+	var users []slackUser
+	if err := readArchiveJSON(zr, "users.json", &users); err != nil {
+		return nil, xerror.New(xerror.CodeInvalidParams, "archive does not contain a valid users.json")
+	}
+
+	// Collect the daily files of every channel directory
+	days := make(map[string][]string)
+	for _, f := range zr.File {
+		dir, file := path.Split(f.Name)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" || strings.Contains(dir, "/") || path.Ext(file) != ".json" {
+			continue
+		}
+		days[dir] = append(days[dir], f.Name)
+	}
+	if channel == "" {
+		if len(days) != 1 {
+			return nil, xerror.New(xerror.CodeInvalidParams, "archive contains several channels, please specify one")
+		}
+		for name := range days {
+			channel = name
+		}
+	}
+	files, ok := days[channel]
+	if !ok {
+		return nil, xerror.New(xerror.CodeNotFound, "channel not found in archive")
+	}
+	sort.Strings(files) // daily files are named YYYY-MM-DD.json
+
+	src := &importSource{Name: channel}
+
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		name := u.Profile.DisplayName
+		if name == "" {
+			name = u.RealName
+		}
+		if name == "" {
+			name = u.Name
+		}
+		usernames[u.ID] = u.Name
+		src.Users = append(src.Users, importedUser{
+			Key:      u.ID,
+			Username: u.Name,
+			Email:    u.Profile.Email,
+			Name:     name,
+		})
+	}
+
+	for _, name := range files {
+		var day []slackMessage
+		if err := readArchiveJSON(zr, name, &day); err != nil {
+			return nil, xerror.New(xerror.CodeInvalidParams, fmt.Sprintf("invalid message file %s", name))
+		}
+
+		for _, sm := range day {
+			if sm.Type != "message" || sm.User == "" || slackSkippedSubtypes[sm.Subtype] {
+				continue
+			}
+			createdAt, err := parseSlackTs(sm.Ts)
+			if err != nil {
+				continue
+			}
+
+			text := slackMentionPattern.ReplaceAllStringFunc(sm.Text, func(s string) string {
+				id := slackMentionPattern.FindStringSubmatch(s)[1]
+				if name, ok := usernames[id]; ok {
+					return "@" + name
+				}
+				return "@" + id
+			})
+			text = slackLinkPattern.ReplaceAllStringFunc(text, func(s string) string {
+				parts := slackLinkPattern.FindStringSubmatch(s)
+				if parts[2] == "" || parts[2] == parts[1] {
+					return parts[1]
+				}
+				return fmt.Sprintf("%s (%s)", parts[2], parts[1])
+			})
+			text = slackHTMLEntities.Replace(text)
+
+			if text != "" {
+				src.Messages = append(src.Messages, importedMessage{
+					SenderKey: sm.User,
+					Content:   text,
+					Type:      chat.MessageTypeText,
+					CreatedAt: createdAt,
+				})
+			}
+
+			// Each Slack attachment becomes its own file message. Exporters
+			// that download attachments place them under <channel>/attachments/.
+			for _, file := range sm.Files {
+				mType := chat.MessageTypeFile
+				if strings.HasPrefix(file.Mimetype, "image/") {
+					mType = chat.MessageTypeImage
+				}
+				src.Messages = append(src.Messages, importedMessage{
+					SenderKey: sm.User,
+					Type:      mType,
+					CreatedAt: createdAt,
+					FilePath:  path.Join(channel, "attachments", file.ID+"-"+file.Name),
+					FileName:  file.Name,
+					FileSize:  file.Size,
+				})
+			}
+		}
+	}
+	return src, nil
+}
+
+// parseSlackTs converts a Slack "seconds.micros" timestamp.
+func parseSlackTs(ts string) (time.Time, error) {
+	secStr, usecStr, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var usec int64
+	if usecStr != "" {
+		usec, _ = strconv.ParseInt(usecStr, 10, 64)
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond)), nil
+}
@@ -0,0 +1,392 @@
+package command
+
+import (
+	"archive/zip"
+	"bytes"
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/xerror"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goChatExportJSON = `{
+	"room": {"name": "Team", "avatar": "/uploads/team.png"},
+	"members": [
+		{"id": 1, "username": "alice", "nickname": "Alice", "email": "alice@example.com"},
+		{"id": 2, "username": "bob", "email": "bob@example.com"}
+	],
+	"messages": [
+		{"id": 11, "created_at": "2024-01-01T10:00:00Z", "sender": {"id": 1, "username": "alice", "nickname": "Alice"}, "content": "hello", "type": "text", "mentions": [2]},
+		{"id": 12, "created_at": "2024-01-01T09:00:00Z", "sender": {"id": 3, "username": "carol"}, "content": "", "type": "image", "file_url": "/uploads/cat.png", "file_name": "cat.png", "file_size": 42},
+		{"id": 13, "created_at": "2024-01-01T11:00:00Z", "sender": {"id": 2, "username": "bob"}, "content": "alice joined", "type": "system"}
+	]
+}`
+
+func buildZip(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestParseGoChatExport(t *testing.T) {
+	src, err := parseGoChatExport(strings.NewReader(goChatExportJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Name != "Team" || src.Avatar != "/uploads/team.png" {
+		t.Errorf("room = %q %q", src.Name, src.Avatar)
+	}
+
+	// Members first, then senders not listed as members, each once
+	wantUsers := []importedUser{
+		{Key: "1", Username: "alice", Email: "alice@example.com", Name: "Alice"},
+		{Key: "2", Username: "bob", Email: "bob@example.com", Name: "bob"},
+		{Key: "3", Username: "carol", Name: "carol"},
+	}
+	if len(src.Users) != len(wantUsers) {
+		t.Fatalf("users = %+v, want %+v", src.Users, wantUsers)
+	}
+	for i, want := range wantUsers {
+		if src.Users[i] != want {
+			t.Errorf("user %d = %+v, want %+v", i, src.Users[i], want)
+		}
+	}
+
+	if len(src.Messages) != 3 {
+		t.Fatalf("messages = %+v, want 3", src.Messages)
+	}
+	img := src.Messages[1]
+	if img.SenderKey != "3" || img.Type != chat.MessageTypeImage || img.FilePath != "uploads/cat.png" ||
+		img.FileName != "cat.png" || img.FileSize != 42 {
+		t.Errorf("image message = %+v", img)
+	}
+	if want := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC); !img.CreatedAt.Equal(want) {
+		t.Errorf("image created at %v, want %v", img.CreatedAt, want)
+	}
+}
+
+func TestParseGoChatArchive(t *testing.T) {
+	if _, err := parseGoChatArchive(buildZip(t, map[string]string{"other.json": "{}"})); err == nil {
+		t.Error("archive without export.json accepted")
+	}
+	src, err := parseGoChatArchive(buildZip(t, map[string]string{"export.json": goChatExportJSON}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(src.Messages) != 3 {
+		t.Errorf("messages = %d, want 3", len(src.Messages))
+	}
+	if _, err := parseGoChatExport(strings.NewReader("not json")); err == nil {
+		t.Error("invalid document accepted")
+	}
+}
+
+func slackArchive(t *testing.T, extra map[string]string) *zip.Reader {
+	files := map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice", "real_name": "Alice A", "profile": {"email": "alice@example.com", "display_name": "ali"}},
+			{"id": "U2", "name": "bob", "real_name": "Bob B", "profile": {}}
+		]`,
+		"general/2024-01-02.json": `[
+			{"type": "message", "user": "U2", "text": "second day", "ts": "1704196800.000200"}
+		]`,
+		"general/2024-01-01.json": `[
+			{"type": "message", "user": "U1", "text": "hi <@U2|bob> see <https://example.com|the site> &amp; <https://example.org>", "ts": "1704110400.123456"},
+			{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined", "ts": "1704110401.000000"},
+			{"type": "message", "user": "", "text": "bot", "ts": "1704110402.000000"},
+			{"type": "message", "user": "U1", "text": "", "ts": "1704110403.000000",
+			 "files": [{"id": "F1", "name": "pic.png", "mimetype": "image/png", "size": 10}, {"id": "F2", "name": "doc.pdf", "mimetype": "application/pdf", "size": 20}]},
+			{"type": "message", "user": "U1", "text": "bad ts", "ts": "x"}
+		]`,
+	}
+	for name, content := range extra {
+		files[name] = content
+	}
+	return buildZip(t, files)
+}
+
+func TestParseSlackArchive(t *testing.T) {
+	src, err := parseSlackArchive(slackArchive(t, nil), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Name != "general" {
+		t.Errorf("name = %q, want general", src.Name)
+	}
+	if len(src.Users) != 2 || src.Users[0].Name != "ali" || src.Users[1].Name != "Bob B" ||
+		src.Users[0].Email != "alice@example.com" || src.Users[0].Username != "alice" {
+		t.Errorf("users = %+v", src.Users)
+	}
+
+	var got []string
+	for _, m := range src.Messages {
+		got = append(got, string(m.Type)+":"+m.Content+m.FilePath)
+	}
+	want := []string{
+		"text:hi @bob see the site (https://example.com) & https://example.org",
+		"image:general/attachments/F1-pic.png",
+		"file:general/attachments/F2-doc.pdf",
+		"text:second day",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	first := src.Messages[0]
+	if first.SenderKey != "U1" || !first.CreatedAt.Equal(time.Unix(1704110400, 123456000)) {
+		t.Errorf("first message = %+v", first)
+	}
+}
+
+func TestParseSlackArchiveChannels(t *testing.T) {
+	zr := slackArchive(t, map[string]string{
+		"random/2024-01-01.json": `[{"type": "message", "user": "U2", "text": "elsewhere", "ts": "1704110400.000000"}]`,
+	})
+	if _, err := parseSlackArchive(zr, ""); err == nil {
+		t.Error("ambiguous channel accepted")
+	}
+	if _, err := parseSlackArchive(zr, "missing"); err == nil {
+		t.Error("unknown channel accepted")
+	}
+	src, err := parseSlackArchive(zr, "random")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(src.Messages) != 1 || src.Messages[0].Content != "elsewhere" {
+		t.Errorf("messages = %+v", src.Messages)
+	}
+	if _, err := parseSlackArchive(buildZip(t, map[string]string{"general/2024-01-01.json": "[]"}), ""); err == nil {
+		t.Error("archive without users.json accepted")
+	}
+}
+
+// Fakes for replaying an import. Unused methods fall through to the nil
+// embedded interfaces and panic.
+
+type importUserRepo struct {
+	user.Repository
+	users []user.User
+}
+
+func (r *importUserRepo) GetByUsername(username string) (*user.User, error) {
+	for i := range r.users {
+		if r.users[i].Username == username {
+			return &r.users[i], nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (r *importUserRepo) GetByEmail(email string) (*user.User, error) {
+	for i := range r.users {
+		if r.users[i].Email == email {
+			return &r.users[i], nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+type importRoomRepo struct {
+	room.Repository
+	created *room.Room
+	members []uint
+	roles   map[uint]room.Role
+}
+
+func (r *importRoomRepo) Create(rm *room.Room) error {
+	rm.ID = 100
+	r.created = rm
+	return nil
+}
+
+func (r *importRoomRepo) AddMember(roomID, userID uint) error {
+	r.members = append(r.members, userID)
+	return nil
+}
+
+func (r *importRoomRepo) SetRole(roomID, userID uint, role room.Role) error {
+	if r.roles == nil {
+		r.roles = make(map[uint]room.Role)
+	}
+	r.roles[userID] = role
+	return nil
+}
+
+func (r *importRoomRepo) GetByID(id uint) (*room.Room, error) {
+	return r.created, nil
+}
+
+type importMessageRepo struct {
+	chat.Repository
+	saved []chat.Message
+}
+
+func (r *importMessageRepo) CreateBatch(messages []chat.Message) error {
+	r.saved = append(r.saved, messages...)
+	return nil
+}
+
+type importInvitationRepo struct {
+	room.InvitationRepository
+	created []room.Invitation
+}
+
+func (r *importInvitationRepo) Create(inv *room.Invitation) error {
+	r.created = append(r.created, *inv)
+	return nil
+}
+
+func newTestImportHandler(users *importUserRepo, rooms *importRoomRepo, messages *importMessageRepo, invitations *importInvitationRepo, importers ...uint) *ImportHandler {
+	h := NewImportHandler(users, rooms, messages, invitations, &ModerationHandler{})
+	for _, id := range importers {
+		h.importers[id] = true
+	}
+	return h
+}
+
+func TestImportAttribution(t *testing.T) {
+	const importer = 9
+	users := &importUserRepo{users: []user.User{
+		{Username: "alice", Email: "alice@example.com"},
+		{Email: "bob@example.com"},
+		{Username: "importer"},
+	}}
+	users.users[0].ID = 1
+	users.users[1].ID = 2
+	users.users[2].ID = importer
+	rooms := &importRoomRepo{}
+	messages := &importMessageRepo{}
+	invitations := &importInvitationRepo{}
+	h := newTestImportHandler(users, rooms, messages, invitations, importer)
+
+	doc := []byte(goChatExportJSON)
+	result, err := h.Import(importer, bytes.NewReader(doc), int64(len(doc)), "export.json", ImportOptions{Format: ImportFormatGoChat})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rooms.created.CreatorID != importer || len(rooms.members) != 1 || rooms.members[0] != importer ||
+		rooms.roles[importer] != room.RoleOwner {
+		t.Errorf("room creator=%d members=%v roles=%v, want only the importer as owner",
+			rooms.created.CreatorID, rooms.members, rooms.roles)
+	}
+
+	// Matched authors are invited, not added
+	invited := map[uint]bool{}
+	for _, inv := range invitations.created {
+		if inv.InviterID != importer || inv.Status != room.InvitationPending {
+			t.Errorf("invitation = %+v", inv)
+		}
+		invited[inv.InviteeID] = true
+	}
+	if len(invited) != 2 || !invited[1] || !invited[2] || len(result.Invitations) != 2 {
+		t.Errorf("invited = %v, want users 1 and 2", invited)
+	}
+	if len(result.UnmappedUsers) != 1 || result.UnmappedUsers[0] != "carol" {
+		t.Errorf("unmapped = %v, want [carol]", result.UnmappedUsers)
+	}
+
+	// The system message is skipped; the image file is missing from a bare
+	// JSON upload and falls back to text. Alice's message is hers; carol is
+	// unmapped, so hers is posted by the importer (her image had no text to
+	// prefix). No mentions survive.
+	if result.Imported != 2 || result.Skipped != 1 || result.MissingFiles != 1 {
+		t.Errorf("imported=%d skipped=%d missing=%d, want 2 1 1", result.Imported, result.Skipped, result.MissingFiles)
+	}
+	want := []struct {
+		sender  uint
+		content string
+	}{{importer, "cat.png"}, {1, "hello"}}
+	if len(messages.saved) != len(want) {
+		t.Fatalf("saved %d messages, want %d", len(messages.saved), len(want))
+	}
+	for i, m := range messages.saved {
+		if m.SenderID != want[i].sender || m.Content != want[i].content {
+			t.Errorf("message %d from %d %q, want from %d %q", i, m.SenderID, m.Content, want[i].sender, want[i].content)
+		}
+		if len(m.Mentions) != 0 || m.Type != chat.MessageTypeText || m.Format != chat.TextFormatPlain {
+			t.Errorf("message %d = %+v", i, m)
+		}
+	}
+}
+
+func TestImportPrefixesUnmappedAuthors(t *testing.T) {
+	const importer = 9
+	messages := &importMessageRepo{}
+	h := newTestImportHandler(&importUserRepo{}, &importRoomRepo{}, messages, &importInvitationRepo{}, importer)
+
+	doc := []byte(goChatExportJSON)
+	if _, err := h.Import(importer, bytes.NewReader(doc), int64(len(doc)), "export.json", ImportOptions{Format: ImportFormatGoChat}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages.saved {
+		if m.SenderID != importer {
+			t.Errorf("unmapped message sent by %d", m.SenderID)
+		}
+	}
+	if got := messages.saved[len(messages.saved)-1].Content; got != "[Alice] hello" {
+		t.Errorf("content = %q, want the author's name prefixed", got)
+	}
+}
+
+func TestImportSkipsRawHTML(t *testing.T) {
+	const importer = 9
+	messages := &importMessageRepo{}
+	h := newTestImportHandler(&importUserRepo{}, &importRoomRepo{}, messages, &importInvitationRepo{}, importer)
+
+	doc := []byte(`{"room": {"name": "x"}, "messages": [
+		{"sender": {"id": 1, "username": "a"}, "content": "<script>alert(1)</script>", "type": "text"},
+		{"sender": {"id": 1, "username": "a"}, "content": "fine", "type": "text"}
+	]}`)
+	result, err := h.Import(importer, bytes.NewReader(doc), int64(len(doc)), "export.json", ImportOptions{Format: ImportFormatGoChat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Skipped != 1 || messages.saved[0].Content != "[a] fine" {
+		t.Errorf("imported=%d skipped=%d saved=%+v", result.Imported, result.Skipped, messages.saved)
+	}
+}
+
+func TestImportRequiresOperator(t *testing.T) {
+	rooms := &importRoomRepo{}
+	h := newTestImportHandler(&importUserRepo{}, rooms, &importMessageRepo{}, &importInvitationRepo{}, 9)
+
+	doc := []byte(goChatExportJSON)
+	_, err := h.Import(1, bytes.NewReader(doc), int64(len(doc)), "export.json", ImportOptions{Format: ImportFormatGoChat})
+	var xerr *xerror.Error
+	if !errors.As(err, &xerr) || xerr.Code != xerror.CodePermissionDenied {
+		t.Fatalf("err = %v, want permission denied", err)
+	}
+	if rooms.created != nil {
+		t.Error("room created for a non-operator")
+	}
+}
+
+func TestImportRejectsSlackJSON(t *testing.T) {
+	h := newTestImportHandler(nil, nil, nil, nil, 1)
+	doc := []byte("[]")
+	if _, err := h.Import(1, bytes.NewReader(doc), int64(len(doc)), "users.json", ImportOptions{Format: ImportFormatSlack}); err == nil {
+		t.Error("bare JSON accepted as a Slack export")
+	}
+}
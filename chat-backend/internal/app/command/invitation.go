@@ -0,0 +1,63 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"time"
+)
+
+// ListInvitations returns the group invitations awaiting userID's answer.
+func (h *RoomHandler) ListInvitations(userID uint) ([]room.Invitation, error) {
+	invitations, err := h.invitationRepo.ListPending(userID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to list invitations")
+	}
+	return invitations, nil
+}
+
+// RespondInvitation accepts or declines an invitation addressed to userID.
+// Accepting adds the user to the room, which is returned along with the
+// member_joined system message.
+func (h *RoomHandler) RespondInvitation(invitationID uint, userID uint, accept bool) (*room.Invitation, *room.Room, []chat.Message, error) {
+	invitation, err := h.invitationRepo.GetByID(invitationID)
+	if err != nil || invitation.InviteeID != userID {
+		return nil, nil, nil, xerror.New(xerror.CodeNotFound, "invitation not found")
+	}
+	if invitation.Status != room.InvitationPending {
+		return nil, nil, nil, xerror.New(xerror.CodeInvalidParams, "invitation has already been answered")
+	}
+	rm, err := h.roomRepo.GetByID(invitation.RoomID)
+	if err != nil {
+		return nil, nil, nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+
+	if accept {
+		if err := h.authz.RequireNotBanned(userID, rm.ID); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := h.authz.RequireCapacity(rm, 1); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := h.roomRepo.AddMember(rm.ID, userID); err != nil {
+			return nil, nil, nil, xerror.New(xerror.CodeInternalError, "failed to join room")
+		}
+		h.roomRepo.SetHidden(rm.ID, userID, false)
+		invitation.Status = room.InvitationAccepted
+	} else {
+		invitation.Status = room.InvitationDeclined
+	}
+	now := time.Now()
+	invitation.RespondedAt = &now
+	if err := h.invitationRepo.Update(invitation); err != nil {
+		return nil, nil, nil, xerror.New(xerror.CodeInternalError, "failed to update invitation")
+	}
+
+	if !accept {
+		return invitation, rm, nil, nil
+	}
+	if updated, err := h.roomRepo.GetByID(rm.ID); err == nil {
+		rm = updated
+	}
+	return invitation, rm, h.system.MemberJoined(rm.ID, userID), nil
+}
@@ -0,0 +1,237 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/qrcode"
+	"chat-backend/pkg/xerror"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Pixels per QR module in invite PNGs
+const inviteQRScale = 8
+
+type InviteHandler struct {
+	inviteRepo   room.InviteRepository
+	roomRepo     room.Repository
+	authz        *AuthzHandler
+	joinRequests *JoinRequestHandler
+	system       *SystemMessageHandler
+}
+
+func NewInviteHandler(inviteRepo room.InviteRepository, roomRepo room.Repository, authz *AuthzHandler, joinRequests *JoinRequestHandler, system *SystemMessageHandler) *InviteHandler {
+	return &InviteHandler{inviteRepo: inviteRepo, roomRepo: roomRepo, authz: authz, joinRequests: joinRequests, system: system}
+}
+
+// JoinResult is the outcome of redeeming an invite: either the room joined,
+// with the member_joined system message to broadcast, or a join request
+// awaiting approval.
+type JoinResult struct {
+	Room        *room.Room
+	JoinRequest *room.JoinRequest
+	Messages    []chat.Message
+}
+
+type InviteOptions struct {
+	ExpiresIn        time.Duration // 0 never expires
+	MaxUses          int           // 0 is unlimited
+	RequiresApproval bool
+}
+
+// CreateInvite issues a new invite token for a group. Anyone allowed to add
+// members may create one.
+func (h *InviteHandler) CreateInvite(roomID uint, operatorID uint, opts InviteOptions) (*room.Invite, error) {
+	if opts.ExpiresIn < 0 || opts.MaxUses < 0 {
+		return nil, xerror.New(xerror.CodeInvalidParams, "expiry and max uses must not be negative")
+	}
+	rm, err := h.groupForAdmin(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to generate invite token")
+	}
+	invite := &room.Invite{
+		RoomID:           rm.ID,
+		CreatorID:        operatorID,
+		Token:            token,
+		MaxUses:          opts.MaxUses,
+		RequiresApproval: opts.RequiresApproval,
+	}
+	if opts.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(opts.ExpiresIn)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := h.inviteRepo.Create(invite); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to create invite")
+	}
+	return invite, nil
+}
+
+// ListInvites returns every invite of the room, including revoked and used
+// up ones, with their usage counts.
+func (h *InviteHandler) ListInvites(roomID uint, operatorID uint) ([]room.Invite, error) {
+	if _, err := h.groupForAdmin(roomID, operatorID); err != nil {
+		return nil, err
+	}
+	invites, err := h.inviteRepo.ListByRoom(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to list invites")
+	}
+	return invites, nil
+}
+
+func (h *InviteHandler) RevokeInvite(roomID uint, inviteID uint, operatorID uint) error {
+	invite, err := h.roomInvite(roomID, inviteID, operatorID)
+	if err != nil {
+		return err
+	}
+	if err := h.inviteRepo.Revoke(invite.ID); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to revoke invite")
+	}
+	return nil
+}
+
+// InviteQRCode renders the invite link as a PNG QR code.
+func (h *InviteHandler) InviteQRCode(roomID uint, inviteID uint, operatorID uint) ([]byte, error) {
+	invite, err := h.roomInvite(roomID, inviteID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	png, err := qrcode.PNG(InviteLink(invite.Token), inviteQRScale)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to render QR code")
+	}
+	return png, nil
+}
+
+// Preview describes the room behind a token so that the join page can show
+// it before the user commits.
+func (h *InviteHandler) Preview(token string) (*room.Invite, *room.Room, error) {
+	invite, err := h.usableInvite(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	rm, err := h.roomRepo.GetByID(invite.RoomID)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "invite not found")
+	}
+	return invite, rm, nil
+}
+
+// Join redeems an invite for userID. Joining a room one already belongs to
+// succeeds without using up the invite. Invites requiring approval file a
+// join request with note instead; the use is counted when it is filed, and
+// joining again while it is pending only updates the note.
+func (h *InviteHandler) Join(token string, userID uint, note string) (*JoinResult, error) {
+	invite, err := h.usableInvite(token)
+	if err != nil {
+		return nil, err
+	}
+	rm, err := h.roomRepo.GetByID(invite.RoomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "invite not found")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) != "" {
+		return &JoinResult{Room: rm}, nil
+	}
+	if err := h.authz.RequireNotBanned(userID, rm.ID); err != nil {
+		return nil, err
+	}
+	if !invite.RequiresApproval {
+		if err := h.authz.RequireCapacity(rm, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if !invite.RequiresApproval || !h.joinRequests.HasPending(rm.ID, userID) {
+		ok, err := h.inviteRepo.Consume(invite.ID)
+		if err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to redeem invite")
+		}
+		if !ok {
+			return nil, xerror.New(xerror.CodeExpired, "invite has expired or reached its usage limit")
+		}
+	}
+
+	if invite.RequiresApproval {
+		req, err := h.joinRequests.Submit(rm, userID, note, &invite.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &JoinResult{Room: rm, JoinRequest: req}, nil
+	}
+
+	if err := h.roomRepo.AddMember(rm.ID, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to join room")
+	}
+	h.roomRepo.SetHidden(rm.ID, userID, false)
+	rm, err = h.roomRepo.GetByID(rm.ID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to join room")
+	}
+	return &JoinResult{Room: rm, Messages: h.system.MemberJoined(rm.ID, userID)}, nil
+}
+
+// InviteLink is the URL encoded in invite QR codes.
+func InviteLink(token string) string {
+	base := viper.GetString("invite.base_url")
+	if base == "" {
+		base = "http://localhost"
+	}
+	return strings.TrimRight(base, "/") + "/invite/" + token
+}
+
+func (h *InviteHandler) usableInvite(token string) (*room.Invite, error) {
+	invite, err := h.inviteRepo.GetByToken(token)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "invite not found")
+	}
+	if !invite.Usable(time.Now()) {
+		return nil, xerror.New(xerror.CodeExpired, "invite has expired or reached its usage limit")
+	}
+	return invite, nil
+}
+
+func (h *InviteHandler) groupForAdmin(roomID uint, operatorID uint) (*room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, xerror.New(xerror.CodeInvalidParams, "invites are only available for group rooms")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermAddMembers); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
+
+func (h *InviteHandler) roomInvite(roomID uint, inviteID uint, operatorID uint) (*room.Invite, error) {
+	if _, err := h.groupForAdmin(roomID, operatorID); err != nil {
+		return nil, err
+	}
+	invite, err := h.inviteRepo.GetByID(inviteID)
+	if err != nil || invite.RoomID != roomID {
+		return nil, xerror.New(xerror.CodeNotFound, "invite not found")
+	}
+	return invite, nil
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"chat-backend/internal/domain/room"
+	"errors"
+	"testing"
+)
+
+type joinInviteRepo struct {
+	room.InviteRepository
+	invite room.Invite
+}
+
+func (r *joinInviteRepo) GetByToken(token string) (*room.Invite, error) {
+	if token != r.invite.Token {
+		return nil, errors.New("not found")
+	}
+	invite := r.invite
+	return &invite, nil
+}
+
+func (r *joinInviteRepo) Consume(id uint) (bool, error) {
+	if r.invite.MaxUses > 0 && r.invite.Uses >= r.invite.MaxUses {
+		return false, nil
+	}
+	r.invite.Uses++
+	return true, nil
+}
+
+type joinBanRepo struct {
+	room.BanRepository
+}
+
+func (joinBanRepo) IsBanned(roomID uint, userID uint) (bool, error) {
+	return false, nil
+}
+
+type joinRequestRepo struct {
+	room.JoinRequestRepository
+	requests []*room.JoinRequest
+}
+
+func (r *joinRequestRepo) GetPending(roomID uint, userID uint) (*room.JoinRequest, error) {
+	for _, req := range r.requests {
+		if req.RoomID == roomID && req.UserID == userID && req.Status == room.JoinRequestPending {
+			return req, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (r *joinRequestRepo) Create(req *room.JoinRequest) error {
+	req.ID = uint(len(r.requests) + 1)
+	r.requests = append(r.requests, req)
+	return nil
+}
+
+func (r *joinRequestRepo) Update(req *room.JoinRequest) error {
+	return nil
+}
+
+func TestJoinApprovalInviteCountsOneUse(t *testing.T) {
+	rooms := leaveGroup()
+	invites := &joinInviteRepo{invite: room.Invite{ID: 1, RoomID: 5, Token: "tok", MaxUses: 5, RequiresApproval: true}}
+	requests := &joinRequestRepo{}
+	authz := NewAuthzHandler(rooms, nil, joinBanRepo{}, room.Limits{})
+	joinRequests := NewJoinRequestHandler(requests, rooms, authz, nil)
+	h := NewInviteHandler(invites, rooms, authz, joinRequests, nil)
+
+	for i, note := range []string{"first", "second", "third"} {
+		result, err := h.Join("tok", 3, note)
+		if err != nil {
+			t.Fatalf("join %d: %v", i+1, err)
+		}
+		if result.JoinRequest == nil || result.JoinRequest.Note != note {
+			t.Fatalf("join %d request = %+v", i+1, result.JoinRequest)
+		}
+	}
+	if invites.invite.Uses != 1 {
+		t.Errorf("Uses = %d after repeated joins, want 1", invites.invite.Uses)
+	}
+	if len(requests.requests) != 1 {
+		t.Errorf("filed %d requests, want 1", len(requests.requests))
+	}
+
+	// Another user's request is a new use
+	if _, err := h.Join("tok", 4, ""); err != nil {
+		t.Fatal(err)
+	}
+	if invites.invite.Uses != 2 {
+		t.Errorf("Uses = %d after a second user joined, want 2", invites.invite.Uses)
+	}
+}
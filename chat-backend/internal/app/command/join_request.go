@@ -0,0 +1,163 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"time"
+	"unicode/utf8"
+)
+
+// Max length of the note attached to a join request
+const maxJoinNoteLength = 500
+
+type JoinRequestHandler struct {
+	joinRequestRepo room.JoinRequestRepository
+	roomRepo        room.Repository
+	authz           *AuthzHandler
+	system          *SystemMessageHandler
+}
+
+func NewJoinRequestHandler(joinRequestRepo room.JoinRequestRepository, roomRepo room.Repository, authz *AuthzHandler, system *SystemMessageHandler) *JoinRequestHandler {
+	return &JoinRequestHandler{joinRequestRepo: joinRequestRepo, roomRepo: roomRepo, authz: authz, system: system}
+}
+
+// Submit files a request for userID to join rm. A second request while one
+// is pending only updates its note. The caller decides whether the user may
+// ask at all (an approval invite, Request for a channel).
+func (h *JoinRequestHandler) Submit(rm *room.Room, userID uint, note string, inviteID *uint) (*room.JoinRequest, error) {
+	if utf8.RuneCountInString(note) > maxJoinNoteLength {
+		return nil, xerror.New(xerror.CodeInvalidParams, "note must be at most 500 characters")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) != "" {
+		return nil, xerror.New(xerror.CodeAlreadyExists, "you are already a member of this room")
+	}
+	if err := h.authz.RequireNotBanned(userID, rm.ID); err != nil {
+		return nil, err
+	}
+
+	if req, err := h.joinRequestRepo.GetPending(rm.ID, userID); err == nil {
+		req.Note = note
+		if err := h.joinRequestRepo.Update(req); err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to update join request")
+		}
+		return req, nil
+	}
+
+	req := &room.JoinRequest{
+		RoomID:   rm.ID,
+		UserID:   userID,
+		InviteID: inviteID,
+		Note:     note,
+		Status:   room.JoinRequestPending,
+	}
+	if err := h.joinRequestRepo.Create(req); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to create join request")
+	}
+	return req, nil
+}
+
+// Request files a join request for a public channel that takes them
+// (Room.JoinApproval); channels without approval are joined directly.
+func (h *JoinRequestHandler) Request(roomID uint, userID uint, note string) (*room.JoinRequest, *room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil || !rm.Type.IsPublic() {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "channel not found")
+	}
+	if !rm.JoinApproval {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "this channel can be joined without approval")
+	}
+	req, err := h.Submit(rm, userID, note, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, rm, nil
+}
+
+// HasPending reports whether userID already has a pending request for the
+// room.
+func (h *JoinRequestHandler) HasPending(roomID uint, userID uint) bool {
+	_, err := h.joinRequestRepo.GetPending(roomID, userID)
+	return err == nil
+}
+
+// ListRequests returns the room's queue for admins; status defaults to
+// pending.
+func (h *JoinRequestHandler) ListRequests(roomID uint, operatorID uint, status room.JoinRequestStatus) ([]room.JoinRequest, error) {
+	if _, err := h.roomForAdmin(roomID, operatorID); err != nil {
+		return nil, err
+	}
+	if status == "" {
+		status = room.JoinRequestPending
+	}
+	reqs, err := h.joinRequestRepo.ListByRoom(roomID, status)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to list join requests")
+	}
+	return reqs, nil
+}
+
+// Review approves or rejects a pending request. Approval adds the user to
+// the room and records a member_joined system message, returned for
+// broadcasting.
+func (h *JoinRequestHandler) Review(roomID uint, requestID uint, operatorID uint, approve bool) (*room.JoinRequest, *room.Room, []chat.Message, error) {
+	rm, err := h.roomForAdmin(roomID, operatorID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	req, err := h.joinRequestRepo.GetByID(requestID)
+	if err != nil || req.RoomID != roomID {
+		return nil, nil, nil, xerror.New(xerror.CodeNotFound, "join request not found")
+	}
+	if req.Status != room.JoinRequestPending {
+		return nil, nil, nil, xerror.New(xerror.CodeInvalidParams, "join request has already been reviewed")
+	}
+
+	if approve {
+		if err := h.authz.RequireNotBanned(req.UserID, roomID); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := h.authz.RequireCapacity(rm, 1); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := h.roomRepo.AddMember(roomID, req.UserID); err != nil {
+			return nil, nil, nil, xerror.New(xerror.CodeInternalError, "failed to add member")
+		}
+		h.roomRepo.SetHidden(roomID, req.UserID, false)
+		req.Status = room.JoinRequestApproved
+	} else {
+		req.Status = room.JoinRequestRejected
+	}
+	now := time.Now()
+	req.ReviewerID = &operatorID
+	req.ReviewedAt = &now
+	if err := h.joinRequestRepo.Update(req); err != nil {
+		return nil, nil, nil, xerror.New(xerror.CodeInternalError, "failed to update join request")
+	}
+
+	if !approve {
+		return req, rm, nil, nil
+	}
+	if updated, err := h.roomRepo.GetByID(roomID); err == nil {
+		rm = updated
+	}
+	if rm.Type == room.RoomTypeBroadcast {
+		// Subscribers come and go without notice, as in JoinChannel
+		return req, rm, nil, nil
+	}
+	return req, rm, h.system.MemberJoined(roomID, req.UserID), nil
+}
+
+func (h *JoinRequestHandler) roomForAdmin(roomID uint, operatorID uint) (*room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermAddMembers); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"errors"
+	"testing"
+)
+
+func approvalChannel() *leaveRoomRepo {
+	rooms := leaveGroup()
+	rooms.rm.Type = room.RoomTypeChannel
+	rooms.rm.JoinApproval = true
+	return rooms
+}
+
+func errCode(err error) xerror.Code {
+	var xerr *xerror.Error
+	if !errors.As(err, &xerr) {
+		return 0
+	}
+	return xerr.Code
+}
+
+func TestRequestJoinChannel(t *testing.T) {
+	rooms := approvalChannel()
+	requests := &joinRequestRepo{}
+	authz := NewAuthzHandler(rooms, nil, joinBanRepo{}, room.Limits{})
+	h := NewJoinRequestHandler(requests, rooms, authz, nil)
+
+	req, rm, err := h.Request(5, 3, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.ID != 5 || req.UserID != 3 || req.Status != room.JoinRequestPending || req.Note != "hi" {
+		t.Fatalf("request = %+v", req)
+	}
+	if _, _, err := h.Request(5, 3, "again"); err != nil || len(requests.requests) != 1 {
+		t.Fatalf("second request: err=%v, %d requests filed, want 1", err, len(requests.requests))
+	}
+
+	if _, _, err := h.Request(5, 2, ""); errCode(err) != xerror.CodeAlreadyExists {
+		t.Errorf("member request err = %v, want already exists", err)
+	}
+
+	// Channels without approval are joined directly, groups are not listed
+	rooms.rm.JoinApproval = false
+	if _, _, err := h.Request(5, 4, ""); errCode(err) != xerror.CodeInvalidParams {
+		t.Errorf("open channel err = %v, want invalid params", err)
+	}
+	rooms.rm.Type = room.RoomTypeGroup
+	rooms.rm.JoinApproval = true
+	if _, _, err := h.Request(5, 4, ""); errCode(err) != xerror.CodeNotFound {
+		t.Errorf("group err = %v, want not found", err)
+	}
+}
+
+func TestJoinChannelRequiresApproval(t *testing.T) {
+	rooms := approvalChannel()
+	h := &RoomHandler{
+		roomRepo: rooms,
+		authz:    NewAuthzHandler(rooms, nil, joinBanRepo{}, room.Limits{}),
+	}
+
+	if _, _, err := h.JoinChannel(5, 3); errCode(err) != xerror.CodePermissionDenied {
+		t.Fatalf("err = %v, want permission denied", err)
+	}
+	// Members are already in; joining again stays a no-op
+	if _, _, err := h.JoinChannel(5, 2); err != nil {
+		t.Fatal(err)
+	}
+}
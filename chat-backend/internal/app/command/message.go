@@ -5,16 +5,48 @@ import (
 	"chat-backend/pkg/xerror"
 )
 
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
 type MessageHandler struct {
 	messageRepo chat.Repository
+	authz       *AuthzHandler
 }
 
-func NewMessageHandler(messageRepo chat.Repository) *MessageHandler {
-	return &MessageHandler{messageRepo: messageRepo}
+func NewMessageHandler(messageRepo chat.Repository, authz *AuthzHandler) *MessageHandler {
+	return &MessageHandler{messageRepo: messageRepo, authz: authz}
 }
 
-func (h *MessageHandler) GetMessages(roomID uint, limit, offset int) ([]chat.Message, error) {
-	return h.messageRepo.GetByRoomID(roomID, limit, offset)
+func (h *MessageHandler) GetMessages(userID uint, roomID uint, limit, offset int) ([]chat.Message, error) {
+	if err := h.authz.RequireReader(userID, roomID, OpReadHistory); err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return h.messageRepo.GetByRoomID(roomID, messagePageSize(limit), offset)
+}
+
+func (h *MessageHandler) SearchMessages(userID uint, roomID uint, query string, limit int) ([]chat.Message, error) {
+	if query == "" {
+		return nil, xerror.New(xerror.CodeInvalidParams, "query is required")
+	}
+	if err := h.authz.RequireReader(userID, roomID, OpReadHistory); err != nil {
+		return nil, err
+	}
+	return h.messageRepo.Search(roomID, query, messagePageSize(limit))
+}
+
+func messagePageSize(limit int) int {
+	if limit <= 0 {
+		return defaultMessagePageSize
+	}
+	if limit > maxMessagePageSize {
+		return maxMessagePageSize
+	}
+	return limit
 }
 
 func (h *MessageHandler) GetByID(id uint) (*chat.Message, error) {
@@ -22,6 +54,9 @@ func (h *MessageHandler) GetByID(id uint) (*chat.Message, error) {
 }
 
 func (h *MessageHandler) MarkAsRead(roomID uint, userID uint, lastReadMessageID uint) error {
+	if err := h.authz.RequireMember(userID, roomID, OpReadReceipt); err != nil {
+		return err
+	}
 	return h.messageRepo.MarkAsRead(roomID, userID, lastReadMessageID)
 }
 
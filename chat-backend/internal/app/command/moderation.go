@@ -0,0 +1,77 @@
+package command
+
+import (
+	"chat-backend/internal/domain/moderation"
+	"chat-backend/pkg/logger"
+	"chat-backend/pkg/sensitive"
+	"chat-backend/pkg/xerror"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type ModerationHandler struct {
+	filter     *sensitive.Filter
+	reviewRepo moderation.Repository
+}
+
+// NewModerationHandler loads the sensitive word lists and watches them for
+// changes. The returned cleanup stops the watcher.
+func NewModerationHandler(reviewRepo moderation.Repository) (*ModerationHandler, func(), error) {
+	var cfg sensitive.Config
+	if err := viper.UnmarshalKey("sensitive", &cfg); err != nil {
+		return nil, nil, err
+	}
+	filter, err := sensitive.New(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	interval := viper.GetDuration("sensitive.reload_interval")
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	stop := make(chan struct{})
+	go filter.Watch(interval, stop, func(err error) {
+		logger.L.Error("failed to reload sensitive word lists", zap.Error(err))
+	})
+
+	return &ModerationHandler{filter: filter, reviewRepo: reviewRepo}, func() { close(stop) }, nil
+}
+
+// Screen runs text through the sensitive word lists. Blocked text is
+// rejected; otherwise the returned result carries the (possibly masked) text
+// to store and whether it must be flagged for review.
+func (h *ModerationHandler) Screen(text string) (sensitive.Result, error) {
+	result := h.filter.Check(text)
+	if result.Blocked {
+		return result, xerror.New(xerror.CodeContentBlocked, "content contains blocked words")
+	}
+	return result, nil
+}
+
+// Flag records content for moderator review when the screen result asks
+// for it. Failures are logged and never block the caller.
+func (h *ModerationHandler) Flag(result sensitive.Result, userID uint, target moderation.TargetType, targetID uint) {
+	if !result.Flagged {
+		return
+	}
+	var hits []sensitive.Hit
+	for _, hit := range result.Hits {
+		if hit.Action == sensitive.ActionReview {
+			hits = append(hits, hit)
+		}
+	}
+	review := &moderation.Review{
+		UserID:     userID,
+		TargetType: target,
+		TargetID:   targetID,
+		Content:    result.Text,
+		Hits:       hits,
+		Status:     moderation.ReviewStatusPending,
+	}
+	if err := h.reviewRepo.Create(review); err != nil {
+		logger.L.Error("failed to record content review", zap.Error(err), zap.Uint("user_id", userID))
+	}
+}
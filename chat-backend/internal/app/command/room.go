@@ -1,77 +1,183 @@
 package command
 
 import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/moderation"
 	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
 	"chat-backend/pkg/xerror"
+	"fmt"
 )
 
 type RoomHandler struct {
-	roomRepo room.Repository
+	roomRepo       room.Repository
+	userRepo       user.Repository
+	messageRepo    chat.Repository
+	invitationRepo room.InvitationRepository
+	banRepo        room.BanRepository
+	moderation     *ModerationHandler
+	authz          *AuthzHandler
+	system         *SystemMessageHandler
 }
 
-func NewRoomHandler(roomRepo room.Repository) *RoomHandler {
-	return &RoomHandler{roomRepo: roomRepo}
+func NewRoomHandler(roomRepo room.Repository, userRepo user.Repository, messageRepo chat.Repository, invitationRepo room.InvitationRepository, banRepo room.BanRepository, moderation *ModerationHandler, authz *AuthzHandler, system *SystemMessageHandler) *RoomHandler {
+	return &RoomHandler{
+		roomRepo:       roomRepo,
+		userRepo:       userRepo,
+		messageRepo:    messageRepo,
+		invitationRepo: invitationRepo,
+		banRepo:        banRepo,
+		moderation:     moderation,
+		authz:          authz,
+		system:         system,
+	}
+}
+
+// AddResult reports which users joined a group directly and which were sent
+// an invitation because their privacy setting asks for consent. Messages
+// are the system messages recorded in the room, to be broadcast.
+type AddResult struct {
+	Added       []uint            `json:"added"`
+	Invitations []room.Invitation `json:"invitations"`
+	Messages    []chat.Message    `json:"-"`
 }
 
-func (h *RoomHandler) CreateRoom(creatorID uint, name string, roomType string, memberIDs []uint) (*room.Room, error) {
-	// If it's a private chat, check if a room already exists between these two users
-	if roomType == string(room.RoomTypePrivate) && len(memberIDs) > 0 {
-		var friendID uint
+// CreateRoom creates a room with the creator as its first member. Group
+// members are added or invited according to their privacy settings; the
+// invitations sent are returned in the AddResult.
+func (h *RoomHandler) CreateRoom(creatorID uint, name string, roomType string, memberIDs []uint) (*room.Room, *AddResult, error) {
+	if !room.RoomType(roomType).Valid() {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "type must be private, group, channel or broadcast")
+	}
+	var others []uint
+	if roomType == string(room.RoomTypePrivate) {
+		seen := map[uint]bool{creatorID: true}
 		for _, id := range memberIDs {
-			if id != creatorID {
-				friendID = id
-				break
+			if !seen[id] {
+				seen[id] = true
+				others = append(others, id)
 			}
 		}
+		if err := h.authz.RequireCapacity(&room.Room{Type: room.RoomTypePrivate, MemberCount: 1}, len(others)); err != nil {
+			return nil, nil, err
+		}
 
-		if friendID > 0 {
+		// Check if a room already exists between these two users
+		if len(others) > 0 {
+			friendID := others[0]
 			rm, err := h.roomRepo.GetPrivateRoomBetweenUsers(creatorID, friendID)
 			if err == nil {
+				if err := h.authz.RequireNotBanned(friendID, rm.ID); err != nil {
+					return nil, nil, err
+				}
 				// Unhide for both users if it exists
 				h.roomRepo.SetHidden(rm.ID, creatorID, false)
 				h.roomRepo.SetHidden(rm.ID, friendID, false)
-				return rm, nil
+				return rm, &AddResult{}, nil
 			}
 		}
 	}
 
+	screened, err := h.moderation.Screen(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	rm := &room.Room{
-		Name:      name,
+		Name:      screened.Text,
 		Type:      room.RoomType(roomType),
 		CreatorID: creatorID,
 	}
 	if err := h.roomRepo.Create(rm); err != nil {
-		return nil, xerror.New(xerror.CodeInternalError, "failed to create room")
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to create room")
 	}
+	h.moderation.Flag(screened, creatorID, moderation.TargetRoomName, rm.ID)
 
 	// Add creator as member
 	if err := h.roomRepo.AddMember(rm.ID, creatorID); err != nil {
-		return nil, xerror.New(xerror.CodeInternalError, "failed to add creator to room")
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to add creator to room")
+	}
+	if rm.Type.IsGroup() {
+		if err := h.roomRepo.SetRole(rm.ID, creatorID, room.RoleOwner); err != nil {
+			return nil, nil, xerror.New(xerror.CodeInternalError, "failed to add creator to room")
+		}
 	}
 
-	// Add other members
-	for _, memberID := range memberIDs {
-		if memberID == creatorID {
-			continue
+	result := &AddResult{}
+	if rm.Type.IsGroup() {
+		if rm, err = h.roomRepo.GetByID(rm.ID); err != nil {
+			return nil, nil, xerror.New(xerror.CodeInternalError, "failed to create room")
 		}
-		if err := h.roomRepo.AddMember(rm.ID, memberID); err != nil {
-			// Log error but continue? Or fail? Let's continue for now.
+		if result, err = h.addOrInvite(rm, creatorID, memberIDs); err != nil {
+			return nil, nil, err
+		}
+		result.Messages = h.system.Post(nil, rm.ID, chat.SystemPayload{
+			Event:   chat.SystemRoomCreated,
+			ActorID: creatorID,
+			UserIDs: result.Added,
+		}, fmt.Sprintf("%s created the %s %q", h.system.DisplayName(creatorID), rm.Type, rm.Name))
+	} else {
+		for _, memberID := range others {
+			if err := h.roomRepo.AddMember(rm.ID, memberID); err != nil {
+				return nil, nil, xerror.New(xerror.CodeInternalError, "failed to add member")
+			}
 		}
 	}
 
-	return h.roomRepo.GetByID(rm.ID)
+	rm, err = h.roomRepo.GetByID(rm.ID)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to create room")
+	}
+	return rm, result, nil
 }
 
-func (h *RoomHandler) GetRooms(userID uint) ([]room.Room, error) {
-	return h.roomRepo.GetByUserID(userID)
+// GetRooms lists the user's conversations, pinned ones first, with their
+// last message, unread count and read status keyed by room id. archived
+// lists the archive instead.
+func (h *RoomHandler) GetRooms(userID uint, archived bool) ([]room.Room, map[uint]*chat.RoomSummary, error) {
+	rooms, err := h.roomRepo.GetByUserID(userID, archived)
+	if err != nil {
+		return nil, nil, err
+	}
+	summaries, err := h.summaries(userID, rooms)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load conversations")
+	}
+	return rooms, summaries, nil
 }
 
-func (h *RoomHandler) GetRoom(roomID uint) (*room.Room, error) {
+func (h *RoomHandler) GetRoom(roomID uint, userID uint) (*room.Room, *chat.RoomSummary, error) {
+	if err := h.authz.RequireReader(userID, roomID, OpViewRoom); err != nil {
+		return nil, nil, err
+	}
 	rm, err := h.roomRepo.GetByID(roomID)
 	if err != nil {
-		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+		return nil, nil, xerror.New(xerror.CodeNotFound, "room not found")
 	}
-	return rm, nil
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	// Channel previews have no unread state to show or keep
+	if rm.RoleOf(userID) == "" {
+		return rm, nil, nil
+	}
+	summaries, err := h.summaries(userID, []room.Room{*rm})
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load room")
+	}
+	return rm, summaries[roomID], nil
+}
+
+func (h *RoomHandler) summaries(userID uint, rooms []room.Room) (map[uint]*chat.RoomSummary, error) {
+	ids := make([]uint, len(rooms))
+	var large []uint
+	for i := range rooms {
+		ids[i] = rooms[i].ID
+		if rooms[i].Large {
+			large = append(large, rooms[i].ID)
+		}
+	}
+	return h.messageRepo.Summaries(userID, ids, large)
 }
 
 func (h *RoomHandler) DeleteRoom(roomID uint, userID uint) error {
@@ -85,61 +191,343 @@ func (h *RoomHandler) DeleteRoom(roomID uint, userID uint) error {
 		return h.roomRepo.SetHidden(roomID, userID, true)
 	}
 
-	// For group rooms, check if creator
-	if rm.CreatorID != userID {
-		return xerror.New(xerror.CodePermissionDenied, "only creator can delete group room")
+	// Only the owner can dissolve a group
+	if err := h.authz.RequirePermission(userID, rm, room.PermDissolve); err != nil {
+		return err
 	}
 
 	return h.roomRepo.Delete(roomID)
 }
 
-func (h *RoomHandler) AddMembers(roomID uint, operatorID uint, memberIDs []uint) error {
+func (h *RoomHandler) AddMembers(roomID uint, operatorID uint, memberIDs []uint) (*AddResult, error) {
 	rm, err := h.roomRepo.GetByID(roomID)
 	if err != nil {
-		return xerror.New(xerror.CodeNotFound, "room not found")
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+
+	if rm.Type.IsGroup() {
+		if err := h.authz.RequirePermission(operatorID, rm, room.PermAddMembers); err != nil {
+			return nil, err
+		}
+		result, err := h.addOrInvite(rm, operatorID, memberIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Added) > 0 {
+			result.Messages = h.system.Post(nil, roomID, chat.SystemPayload{
+				Event:   chat.SystemMemberJoined,
+				ActorID: operatorID,
+				UserIDs: result.Added,
+			}, fmt.Sprintf("%s added %s", h.system.DisplayName(operatorID), h.system.DisplayNames(result.Added)))
+		}
+		return result, nil
 	}
 
-	// Only creator can add members to group room
-	if rm.Type == room.RoomTypeGroup && rm.CreatorID != operatorID {
-		return xerror.New(xerror.CodePermissionDenied, "only creator can add members")
+	if err := h.authz.RequireMember(operatorID, roomID, OpAddMembers); err != nil {
+		return nil, err
+	}
+	if err := h.roomRepo.LoadMemberships(rm, memberIDs...); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	var adding []uint
+	seen := make(map[uint]bool)
+	for _, id := range memberIDs {
+		if seen[id] || rm.RoleOf(id) != "" {
+			continue
+		}
+		seen[id] = true
+		if err := h.authz.RequireNotBanned(id, roomID); err != nil {
+			return nil, err
+		}
+		adding = append(adding, id)
+	}
+	if err := h.authz.RequireCapacity(rm, len(adding)); err != nil {
+		return nil, err
 	}
 
-	for _, memberID := range memberIDs {
+	result := &AddResult{}
+	for _, memberID := range adding {
 		if err := h.roomRepo.AddMember(roomID, memberID); err != nil {
-			return xerror.New(xerror.CodeInternalError, "failed to add member")
+			return nil, xerror.New(xerror.CodeInternalError, "failed to add member")
+		}
+		result.Added = append(result.Added, memberID)
+	}
+	return result, nil
+}
+
+// addOrInvite adds each user whose GroupInvitePolicy allows operatorID to
+// add them directly, and sends everyone else an invitation. Current members
+// and users with a pending invitation are skipped.
+func (h *RoomHandler) addOrInvite(rm *room.Room, operatorID uint, memberIDs []uint) (*AddResult, error) {
+	result := &AddResult{}
+	if err := h.roomRepo.LoadMemberships(rm, memberIDs...); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+
+	seen := map[uint]bool{operatorID: true}
+	var candidates []uint
+	for _, id := range memberIDs {
+		if seen[id] || rm.RoleOf(id) != "" {
+			continue
+		}
+		if err := h.authz.RequireNotBanned(id, rm.ID); err != nil {
+			return nil, err
+		}
+		seen[id] = true
+		candidates = append(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+	// Counted as if everyone were added directly; invitees are checked
+	// again when they accept
+	if err := h.authz.RequireCapacity(rm, len(candidates)); err != nil {
+		return nil, err
+	}
+
+	friendStatus, err := h.userRepo.GetFriendStatus(operatorID, candidates)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to add members")
+	}
+
+	for _, id := range candidates {
+		u, err := h.userRepo.GetByID(id)
+		if err != nil {
+			return nil, xerror.New(xerror.CodeNotFound, "user not found").WithDetail("user_id", id)
+		}
+
+		policy := u.InvitePolicy()
+		direct := policy == user.GroupInviteEveryone ||
+			(policy == user.GroupInviteFriends && friendStatus[id] == string(user.FriendStatusAccepted))
+		if direct {
+			if err := h.roomRepo.AddMember(rm.ID, id); err != nil {
+				return nil, xerror.New(xerror.CodeInternalError, "failed to add member")
+			}
+			result.Added = append(result.Added, id)
+			continue
+		}
+
+		if _, err := h.invitationRepo.GetPending(rm.ID, id); err == nil {
+			continue
+		}
+		invitation := room.Invitation{
+			RoomID:    rm.ID,
+			InviterID: operatorID,
+			InviteeID: id,
+			Status:    room.InvitationPending,
+		}
+		if err := h.invitationRepo.Create(&invitation); err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to create invitation")
 		}
+		result.Invitations = append(result.Invitations, invitation)
 	}
-	return nil
+	return result, nil
 }
 
-func (h *RoomHandler) RemoveMember(roomID uint, operatorID uint, userID uint) error {
+// RemoveMember takes userID out of the room; for groups the removal is
+// recorded as a system message, which is returned.
+func (h *RoomHandler) RemoveMember(roomID uint, operatorID uint, userID uint) ([]chat.Message, error) {
 	rm, err := h.roomRepo.GetByID(roomID)
 	if err != nil {
-		return xerror.New(xerror.CodeNotFound, "room not found")
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
 	}
 
-	// Only creator can remove members from group room
-	if rm.Type == room.RoomTypeGroup && rm.CreatorID != operatorID {
-		return xerror.New(xerror.CodePermissionDenied, "only creator can remove members")
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.Type.IsGroup() {
+		if err := h.authz.RequirePermission(operatorID, rm, room.PermRemoveMembers); err != nil {
+			return nil, err
+		}
+		// Admins cannot remove each other or the owner
+		target := rm.RoleOf(userID)
+		if target == room.RoleOwner {
+			return nil, xerror.New(xerror.CodeInvalidParams, "cannot remove the owner")
+		}
+		if target != "" && !rm.RoleOf(operatorID).Outranks(target) {
+			return nil, xerror.New(xerror.CodePermissionDenied, "only the owner can remove admins")
+		}
+	} else if err := h.authz.RequireMember(operatorID, roomID, OpRemoveMember); err != nil {
+		return nil, err
 	}
 
-	// Cannot remove creator
-	if userID == rm.CreatorID {
-		return xerror.New(xerror.CodeInvalidParams, "cannot remove creator")
+	if err := h.roomRepo.RemoveMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	if !rm.Type.IsGroup() || rm.RoleOf(userID) == "" {
+		return nil, nil
+	}
+	return h.system.Post(nil, roomID, chat.SystemPayload{
+		Event:   chat.SystemMemberRemoved,
+		ActorID: operatorID,
+		UserIDs: []uint{userID},
+	}, fmt.Sprintf("%s removed %s", h.system.DisplayName(operatorID), h.system.DisplayName(userID))), nil
+}
+
+// Max slow mode interval: one hour
+const maxSlowMode = 3600
+
+func (h *RoomHandler) SetSlowMode(roomID uint, operatorID uint, seconds int) (*room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+
+	if !rm.Type.IsGroup() {
+		return nil, xerror.New(xerror.CodeInvalidParams, "slow mode is only available for group rooms")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermModerate); err != nil {
+		return nil, err
+	}
+	if seconds < 0 || seconds > maxSlowMode {
+		return nil, xerror.New(xerror.CodeInvalidParams, "slow mode must be between 0 and 3600 seconds")
 	}
 
-	return h.roomRepo.RemoveMember(roomID, userID)
+	rm.SlowMode = seconds
+	if err := h.roomRepo.Update(rm); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to update room")
+	}
+	return rm, nil
 }
 
-func (h *RoomHandler) LeaveRoom(roomID, userID uint) error {
+// SetMemberRole appoints or demotes an admin. Only the owner may do so;
+// ownership itself moves through a transfer.
+func (h *RoomHandler) SetMemberRole(roomID uint, operatorID uint, userID uint, role room.Role) (*room.Room, error) {
+	if role != room.RoleAdmin && role != room.RoleMember {
+		return nil, xerror.New(xerror.CodeInvalidParams, "role must be admin or member")
+	}
+
 	rm, err := h.roomRepo.GetByID(roomID)
 	if err != nil {
-		return xerror.New(xerror.CodeNotFound, "room not found")
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, xerror.New(xerror.CodeInvalidParams, "roles are only available for group rooms")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermAppointAdmins); err != nil {
+		return nil, err
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+
+	switch rm.RoleOf(userID) {
+	case "":
+		return nil, xerror.New(xerror.CodeNotFound, "user is not a member of this room")
+	case room.RoleOwner:
+		return nil, xerror.New(xerror.CodeInvalidParams, "cannot change the owner's role")
+	}
+
+	if err := h.roomRepo.SetRole(roomID, userID, role); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to update role")
+	}
+	return h.roomRepo.GetByID(roomID)
+}
+
+// TransferOwnership hands a group to another member. The previous owner
+// stays on as an admin.
+func (h *RoomHandler) TransferOwnership(roomID uint, operatorID uint, newOwnerID uint) (*room.Room, []chat.Message, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "only group rooms have an owner")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermTransfer); err != nil {
+		return nil, nil, err
+	}
+	if newOwnerID == operatorID {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "you already own this room")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, newOwnerID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(newOwnerID) == "" {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "user is not a member of this room")
+	}
+
+	if err := h.roomRepo.TransferOwnership(roomID, operatorID, newOwnerID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to transfer ownership")
+	}
+	msgs := h.system.Post(nil, roomID, chat.SystemPayload{
+		Event:   chat.SystemOwnerTransferred,
+		ActorID: operatorID,
+		UserIDs: []uint{newOwnerID},
+	}, fmt.Sprintf("%s transferred ownership to %s", h.system.DisplayName(operatorID), h.system.DisplayName(newOwnerID)))
+
+	rm, err = h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rm, msgs, nil
+}
+
+// LeaveResult describes the aftermath of leaving a group. NewOwnerID is set
+// when ownership changed; Messages are the system messages to broadcast.
+type LeaveResult struct {
+	NewOwnerID uint
+	Messages   []chat.Message
+}
+
+// LeaveRoom removes userID from a group, or hides a private chat. When the
+// owner leaves, ownership passes to the repository's Successor; if nobody is
+// left the group is dissolved.
+func (h *RoomHandler) LeaveRoom(roomID, userID uint) (*LeaveResult, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
 	}
 
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	// Nothing may be changed or announced for a room the caller is not in
+	role := rm.RoleOf(userID)
+	if role == "" {
+		return nil, xerror.New(xerror.CodePermissionDenied, "you are not a member of this room")
+	}
+
+	result := &LeaveResult{}
 	if rm.Type == room.RoomTypePrivate {
-		return h.roomRepo.SetHidden(roomID, userID, true)
+		return result, h.roomRepo.SetHidden(roomID, userID, true)
 	}
 
-	return h.roomRepo.RemoveMember(roomID, userID)
+	if role == room.RoleOwner {
+		successor, ok, err := h.roomRepo.Successor(roomID, userID)
+		if err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to transfer ownership")
+		}
+		if !ok {
+			if err := h.roomRepo.Delete(roomID); err != nil {
+				return nil, xerror.New(xerror.CodeInternalError, "failed to dissolve room")
+			}
+			return result, nil
+		}
+		if err := h.roomRepo.TransferOwnership(roomID, userID, successor); err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to transfer ownership")
+		}
+		result.NewOwnerID = successor
+	}
+
+	if err := h.roomRepo.RemoveMember(roomID, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to leave room")
+	}
+
+	// Broadcast subscribers leave without notice
+	if rm.Type != room.RoomTypeBroadcast {
+		result.Messages = h.system.Post(nil, roomID, chat.SystemPayload{
+			Event:   chat.SystemMemberLeft,
+			ActorID: userID,
+			UserIDs: []uint{userID},
+		}, fmt.Sprintf("%s left the group", h.system.DisplayName(userID)))
+	}
+	if result.NewOwnerID != 0 {
+		result.Messages = h.system.Post(result.Messages, roomID, chat.SystemPayload{
+			Event:   chat.SystemOwnerTransferred,
+			ActorID: userID,
+			UserIDs: []uint{result.NewOwnerID},
+		}, fmt.Sprintf("%s is now the owner", h.system.DisplayName(result.NewOwnerID)))
+	}
+	return result, nil
 }
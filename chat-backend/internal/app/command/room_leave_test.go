@@ -0,0 +1,119 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/xerror"
+	"errors"
+	"testing"
+)
+
+// leaveRoomRepo holds one group room. Methods LeaveRoom must not reach
+// fall through to the nil embedded interface and panic.
+type leaveRoomRepo struct {
+	room.Repository
+	rm      room.Room
+	members []room.RoomMember
+	removed []uint
+}
+
+func (r *leaveRoomRepo) GetByID(id uint) (*room.Room, error) {
+	rm := r.rm
+	return &rm, nil
+}
+
+func (r *leaveRoomRepo) LoadMemberships(rm *room.Room, userIDs ...uint) error {
+	for _, id := range userIDs {
+		for _, m := range r.members {
+			if m.UserID == id {
+				rm.Memberships = append(rm.Memberships, m)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *leaveRoomRepo) RemoveMember(roomID, userID uint) error {
+	r.removed = append(r.removed, userID)
+	return nil
+}
+
+type leaveMessageRepo struct {
+	chat.Repository
+	created []chat.Message
+}
+
+func (r *leaveMessageRepo) Create(m *chat.Message) error {
+	m.ID = uint(len(r.created) + 1)
+	r.created = append(r.created, *m)
+	return nil
+}
+
+func (r *leaveMessageRepo) GetByID(id uint) (*chat.Message, error) {
+	return &r.created[id-1], nil
+}
+
+type leaveUserRepo struct {
+	user.Repository
+}
+
+func (leaveUserRepo) GetByID(id uint) (*user.User, error) {
+	return &user.User{Username: "someone"}, nil
+}
+
+func newLeaveHandler(roomRepo *leaveRoomRepo, messageRepo *leaveMessageRepo) *RoomHandler {
+	return &RoomHandler{
+		roomRepo:    roomRepo,
+		messageRepo: messageRepo,
+		system:      NewSystemMessageHandler(messageRepo, leaveUserRepo{}),
+	}
+}
+
+func leaveGroup() *leaveRoomRepo {
+	return &leaveRoomRepo{
+		rm: room.Room{ID: 5, Type: room.RoomTypeGroup, CreatorID: 1},
+		members: []room.RoomMember{
+			{RoomID: 5, UserID: 1, Role: room.RoleOwner},
+			{RoomID: 5, UserID: 2, Role: room.RoleMember},
+		},
+	}
+}
+
+func TestLeaveRoomRejectsNonMember(t *testing.T) {
+	for _, typ := range []room.RoomType{room.RoomTypeGroup, room.RoomTypeChannel, room.RoomTypePrivate} {
+		t.Run(string(typ), func(t *testing.T) {
+			rooms := leaveGroup()
+			rooms.rm.Type = typ
+			messages := &leaveMessageRepo{}
+
+			_, err := newLeaveHandler(rooms, messages).LeaveRoom(5, 3)
+			var xerr *xerror.Error
+			if !errors.As(err, &xerr) || xerr.Code != xerror.CodePermissionDenied {
+				t.Fatalf("err = %v, want permission denied", err)
+			}
+			if len(messages.created) != 0 {
+				t.Errorf("posted %d system messages for a non-member", len(messages.created))
+			}
+			if len(rooms.removed) != 0 {
+				t.Errorf("removed %v", rooms.removed)
+			}
+		})
+	}
+}
+
+func TestLeaveRoomMember(t *testing.T) {
+	rooms := leaveGroup()
+	messages := &leaveMessageRepo{}
+
+	result, err := newLeaveHandler(rooms, messages).LeaveRoom(5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != 2 {
+		t.Errorf("removed = %v, want [2]", rooms.removed)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].System.Event != chat.SystemMemberLeft {
+		t.Errorf("messages = %+v, want one member_left", result.Messages)
+	}
+}
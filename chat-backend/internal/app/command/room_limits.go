@@ -0,0 +1,20 @@
+package command
+
+import (
+	"chat-backend/internal/domain/room"
+
+	"github.com/spf13/viper"
+)
+
+// LoadRoomLimits reads rooms.member_limits and rooms.large_group_threshold,
+// keeping the defaults for anything not configured.
+func LoadRoomLimits() room.Limits {
+	limits := room.DefaultLimits()
+	for t := range viper.GetStringMap("rooms.member_limits") {
+		limits.MemberLimits[room.RoomType(t)] = viper.GetInt("rooms.member_limits." + t)
+	}
+	if viper.IsSet("rooms.large_group_threshold") {
+		limits.LargeGroupThreshold = viper.GetInt("rooms.large_group_threshold")
+	}
+	return limits
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+)
+
+const (
+	defaultMemberPageSize = 50
+	maxMemberPageSize     = 200
+)
+
+// ListMembers pages through a room's members, owner and admins first, and
+// returns the total member count. It is how clients see who is in a large
+// room, whose members are not included with the room itself.
+func (h *RoomHandler) ListMembers(roomID uint, userID uint, limit int, offset int) ([]room.MemberInfo, int64, error) {
+	if err := h.authz.RequireReader(userID, roomID, OpViewRoom); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = defaultMemberPageSize
+	} else if limit > maxMemberPageSize {
+		limit = maxMemberPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	members, err := h.roomRepo.ListMembers(roomID, limit, offset)
+	if err != nil {
+		return nil, 0, xerror.New(xerror.CodeInternalError, "failed to list members")
+	}
+	total, err := h.roomRepo.MemberCount(roomID)
+	if err != nil {
+		return nil, 0, xerror.New(xerror.CodeInternalError, "failed to list members")
+	}
+	return members, total, nil
+}
@@ -0,0 +1,151 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Longest member mute: 30 days
+const maxMuteDuration = 30 * 24 * time.Hour
+
+const maxBanReasonLength = 255
+
+// MuteMember silences userID in a group for duration; zero lifts the mute.
+// Admins may only mute plain members.
+func (h *RoomHandler) MuteMember(roomID uint, operatorID uint, userID uint, duration time.Duration) (*time.Time, error) {
+	if duration < 0 || duration > maxMuteDuration {
+		return nil, xerror.New(xerror.CodeInvalidParams, "mute duration must be between 0 and 30 days")
+	}
+	rm, err := h.moderatedGroup(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireOutranks(rm, operatorID, userID); err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	if duration > 0 {
+		t := time.Now().Add(duration)
+		until = &t
+	}
+	if err := h.roomRepo.SetMutedUntil(roomID, userID, until); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to update mute")
+	}
+	return until, nil
+}
+
+// SetMuteAll toggles the room-wide mute, after which only the owner and
+// admins can send messages.
+func (h *RoomHandler) SetMuteAll(roomID uint, operatorID uint, muted bool) (*room.Room, error) {
+	rm, err := h.moderatedGroup(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	rm.MuteAll = muted
+	if err := h.roomRepo.Update(rm); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to update room")
+	}
+	return rm, nil
+}
+
+// BanMember removes userID from the group and keeps them out until
+// unbanned. Users who are not members can be banned pre-emptively.
+func (h *RoomHandler) BanMember(roomID uint, operatorID uint, userID uint, reason string) (*room.Ban, []chat.Message, error) {
+	if utf8.RuneCountInString(reason) > maxBanReasonLength {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "reason must be at most 255 characters")
+	}
+	rm, err := h.moderatedGroup(roomID, operatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if userID == operatorID {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "cannot ban yourself")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) != "" {
+		if err := h.requireOutranks(rm, operatorID, userID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ban := &room.Ban{
+		RoomID:   roomID,
+		UserID:   userID,
+		BannedBy: operatorID,
+		Reason:   reason,
+	}
+	if err := h.banRepo.Create(ban); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to ban user")
+	}
+	if rm.RoleOf(userID) == "" {
+		return ban, nil, nil
+	}
+	if err := h.roomRepo.RemoveMember(roomID, userID); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to remove member")
+	}
+	msgs := h.system.Post(nil, roomID, chat.SystemPayload{
+		Event:   chat.SystemMemberRemoved,
+		ActorID: operatorID,
+		UserIDs: []uint{userID},
+		Banned:  true,
+	}, fmt.Sprintf("%s banned %s", h.system.DisplayName(operatorID), h.system.DisplayName(userID)))
+	return ban, msgs, nil
+}
+
+func (h *RoomHandler) UnbanMember(roomID uint, operatorID uint, userID uint) error {
+	if _, err := h.moderatedGroup(roomID, operatorID); err != nil {
+		return err
+	}
+	if err := h.banRepo.Delete(roomID, userID); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to unban user")
+	}
+	return nil
+}
+
+func (h *RoomHandler) ListBans(roomID uint, operatorID uint) ([]room.Ban, error) {
+	if _, err := h.moderatedGroup(roomID, operatorID); err != nil {
+		return nil, err
+	}
+	bans, err := h.banRepo.ListByRoom(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to list bans")
+	}
+	return bans, nil
+}
+
+func (h *RoomHandler) moderatedGroup(roomID uint, operatorID uint) (*room.Room, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, xerror.New(xerror.CodeInvalidParams, "moderation is only available for group rooms")
+	}
+	if err := h.authz.RequirePermission(operatorID, rm, room.PermModerate); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
+
+func (h *RoomHandler) requireOutranks(rm *room.Room, operatorID uint, userID uint) error {
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	target := rm.RoleOf(userID)
+	switch {
+	case target == "":
+		return xerror.New(xerror.CodeNotFound, "user is not a member of this room")
+	case target == room.RoleOwner:
+		return xerror.New(xerror.CodeInvalidParams, "cannot moderate the owner")
+	case !rm.RoleOf(operatorID).Outranks(target):
+		return xerror.New(xerror.CodePermissionDenied, "only the owner can moderate admins")
+	}
+	return nil
+}
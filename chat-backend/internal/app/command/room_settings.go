@@ -0,0 +1,70 @@
+package command
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxRoomAliasLength = 100
+	maxPinOrder        = 1000
+)
+
+// SettingsUpdate is a partial update of a member's conversation settings;
+// nil fields are left alone. Muting without NotifyMutedUntil mutes until
+// turned off; unmuting clears the end time.
+type SettingsUpdate struct {
+	NotifyMuted      *bool
+	NotifyMutedUntil *time.Time
+	PinOrder         *int
+	Alias            *string
+	Archived         *bool
+}
+
+func (h *RoomHandler) UpdateSettings(roomID uint, userID uint, u SettingsUpdate) (*room.MemberSettings, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if err := h.roomRepo.LoadMemberships(rm, userID); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load room members")
+	}
+	if rm.RoleOf(userID) == "" {
+		return nil, xerror.New(xerror.CodePermissionDenied, "you are not a member of this room")
+	}
+
+	s := rm.SettingsOf(userID)
+	if u.NotifyMuted != nil {
+		s.NotifyMuted = *u.NotifyMuted
+		s.NotifyMutedUntil = nil
+	}
+	if u.NotifyMutedUntil != nil {
+		if !u.NotifyMutedUntil.After(time.Now()) {
+			return nil, xerror.New(xerror.CodeInvalidParams, "notify_muted_until must be in the future")
+		}
+		s.NotifyMuted = true
+		s.NotifyMutedUntil = u.NotifyMutedUntil
+	}
+	if u.PinOrder != nil {
+		if *u.PinOrder < 0 || *u.PinOrder > maxPinOrder {
+			return nil, xerror.New(xerror.CodeInvalidParams, "pin_order must be between 0 and 1000")
+		}
+		s.PinOrder = *u.PinOrder
+	}
+	if u.Alias != nil {
+		if utf8.RuneCountInString(*u.Alias) > maxRoomAliasLength {
+			return nil, xerror.New(xerror.CodeInvalidParams, "alias must be at most 100 characters")
+		}
+		s.Alias = *u.Alias
+	}
+	if u.Archived != nil {
+		s.Archived = *u.Archived
+	}
+
+	if err := h.roomRepo.UpdateSettings(roomID, userID, s); err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to update settings")
+	}
+	return &s, nil
+}
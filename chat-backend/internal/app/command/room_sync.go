@@ -0,0 +1,62 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+)
+
+// SyncResult is what changed in a user's conversation list since the
+// version the client holds. A Full result replaces the client's list,
+// archived rooms included.
+type SyncResult struct {
+	Version   uint64
+	Full      bool
+	Rooms     []room.Room
+	Summaries map[uint]*chat.RoomSummary
+	// Removed are rooms the user left, lost or hid
+	Removed []uint
+}
+
+// SyncRooms returns the rooms added or changed in userID's list after
+// since, and those that dropped out of it. since 0 asks for the full list.
+func (h *RoomHandler) SyncRooms(userID uint, since uint64) (*SyncResult, error) {
+	version, changed, complete, err := h.roomRepo.Changes(userID, since)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load changes")
+	}
+	result := &SyncResult{Version: version, Full: !complete}
+
+	if result.Full {
+		for _, archived := range []bool{false, true} {
+			rooms, err := h.roomRepo.GetByUserID(userID, archived)
+			if err != nil {
+				return nil, xerror.New(xerror.CodeInternalError, "failed to load conversations")
+			}
+			result.Rooms = append(result.Rooms, rooms...)
+		}
+	} else {
+		rooms, err := h.roomRepo.GetForUser(userID, changed)
+		if err != nil {
+			return nil, xerror.New(xerror.CodeInternalError, "failed to load conversations")
+		}
+		visible := make(map[uint]bool, len(rooms))
+		for _, rm := range rooms {
+			if !rm.HiddenFor(userID) {
+				visible[rm.ID] = true
+				result.Rooms = append(result.Rooms, rm)
+			}
+		}
+		for _, id := range changed {
+			if !visible[id] {
+				result.Removed = append(result.Removed, id)
+			}
+		}
+	}
+
+	result.Summaries, err = h.summaries(userID, result.Rooms)
+	if err != nil {
+		return nil, xerror.New(xerror.CodeInternalError, "failed to load conversations")
+	}
+	return result, nil
+}
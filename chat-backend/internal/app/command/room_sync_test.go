@@ -0,0 +1,140 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"testing"
+)
+
+// syncRoomRepo serves a fixed change log. Methods SyncRooms does not use
+// fall through to the nil embedded interface and panic.
+type syncRoomRepo struct {
+	room.Repository
+	version  uint64
+	changed  []uint
+	complete bool
+	rooms    map[uint]room.Room
+	archived map[uint]bool
+	since    uint64
+}
+
+func (r *syncRoomRepo) Changes(userID uint, since uint64) (uint64, []uint, bool, error) {
+	r.since = since
+	return r.version, r.changed, r.complete, nil
+}
+
+func (r *syncRoomRepo) GetByUserID(userID uint, archived bool) ([]room.Room, error) {
+	var rooms []room.Room
+	for id, rm := range r.rooms {
+		if r.archived[id] == archived && !rm.HiddenFor(userID) {
+			rooms = append(rooms, rm)
+		}
+	}
+	return rooms, nil
+}
+
+func (r *syncRoomRepo) GetForUser(userID uint, roomIDs []uint) ([]room.Room, error) {
+	var rooms []room.Room
+	for _, id := range roomIDs {
+		if rm, ok := r.rooms[id]; ok {
+			rooms = append(rooms, rm)
+		}
+	}
+	return rooms, nil
+}
+
+type syncMessageRepo struct {
+	chat.Repository
+}
+
+func (syncMessageRepo) Summaries(userID uint, roomIDs []uint, largeRoomIDs []uint) (map[uint]*chat.RoomSummary, error) {
+	summaries := make(map[uint]*chat.RoomSummary, len(roomIDs))
+	for _, id := range roomIDs {
+		summaries[id] = &chat.RoomSummary{}
+	}
+	return summaries, nil
+}
+
+func newSyncHandler(repo *syncRoomRepo) *RoomHandler {
+	return &RoomHandler{roomRepo: repo, messageRepo: syncMessageRepo{}}
+}
+
+func syncRoom(id uint, userID uint, hidden bool) room.Room {
+	return room.Room{
+		ID:          id,
+		Type:        room.RoomTypeGroup,
+		Memberships: []room.RoomMember{{RoomID: id, UserID: userID, IsHidden: hidden}},
+	}
+}
+
+func roomIDs(rooms []room.Room) map[uint]bool {
+	ids := make(map[uint]bool, len(rooms))
+	for _, rm := range rooms {
+		ids[rm.ID] = true
+	}
+	return ids
+}
+
+func TestSyncRoomsIncremental(t *testing.T) {
+	const user = 1
+	repo := &syncRoomRepo{
+		version:  42,
+		changed:  []uint{10, 11, 12},
+		complete: true,
+		rooms: map[uint]room.Room{
+			10: syncRoom(10, user, false),
+			11: syncRoom(11, user, true), // hidden since the cursor
+			// 12 was left: it is no longer returned for the user
+			13: syncRoom(13, user, false), // unchanged
+		},
+	}
+
+	result, err := newSyncHandler(repo).SyncRooms(user, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.since != 40 {
+		t.Errorf("Changes called with since=%d, want 40", repo.since)
+	}
+	if result.Full || result.Version != 42 {
+		t.Fatalf("result Full=%v Version=%d, want incremental at 42", result.Full, result.Version)
+	}
+	if got := roomIDs(result.Rooms); len(got) != 1 || !got[10] {
+		t.Errorf("rooms = %v, want only the visible changed room 10", got)
+	}
+	if len(result.Removed) != 2 || result.Removed[0] != 11 || result.Removed[1] != 12 {
+		t.Errorf("removed = %v, want [11 12]", result.Removed)
+	}
+	if len(result.Summaries) != 1 || result.Summaries[10] == nil {
+		t.Errorf("summaries = %v, want one for room 10", result.Summaries)
+	}
+}
+
+func TestSyncRoomsFull(t *testing.T) {
+	const user = 1
+	repo := &syncRoomRepo{
+		version:  42,
+		complete: false,
+		rooms: map[uint]room.Room{
+			10: syncRoom(10, user, false),
+			11: syncRoom(11, user, false),
+			12: syncRoom(12, user, true),
+		},
+		archived: map[uint]bool{11: true},
+	}
+
+	result, err := newSyncHandler(repo).SyncRooms(user, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Full || result.Version != 42 {
+		t.Fatalf("result Full=%v Version=%d, want full at 42", result.Full, result.Version)
+	}
+	got := roomIDs(result.Rooms)
+	if len(got) != 2 || !got[10] || !got[11] {
+		t.Errorf("rooms = %v, want active and archived rooms 10 and 11", got)
+	}
+	if len(result.Removed) != 0 {
+		t.Errorf("removed = %v, want none on a full sync", result.Removed)
+	}
+}
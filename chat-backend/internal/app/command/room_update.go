@@ -0,0 +1,147 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/moderation"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/xerror"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	maxRoomNameLength        = 100
+	maxRoomDescriptionLength = 500
+)
+
+// RoomUpdate is a partial update of a group; nil fields are left alone.
+// Name, avatar and description need PermEditInfo, the settings
+// PermModerate. JoinApproval applies to public channels only.
+type RoomUpdate struct {
+	Name         *string
+	Avatar       *string
+	Description  *string
+	SlowMode     *int
+	MuteAll      *bool
+	JoinApproval *bool
+}
+
+// roomChange is one effective change of a RoomUpdate and its rendering.
+type roomChange struct {
+	field string
+	value interface{}
+	text  string
+}
+
+// UpdateRoom applies u and records each effective change as a system
+// message in the room ("alice renamed the group to …"). The messages are
+// returned for broadcasting.
+func (h *RoomHandler) UpdateRoom(roomID uint, operatorID uint, u RoomUpdate) (*room.Room, []chat.Message, error) {
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, xerror.New(xerror.CodeNotFound, "room not found")
+	}
+	if !rm.Type.IsGroup() {
+		return nil, nil, xerror.New(xerror.CodeInvalidParams, "only group rooms can be edited")
+	}
+	if u.Name != nil || u.Avatar != nil || u.Description != nil {
+		if err := h.authz.RequirePermission(operatorID, rm, room.PermEditInfo); err != nil {
+			return nil, nil, err
+		}
+	}
+	if u.SlowMode != nil || u.MuteAll != nil || u.JoinApproval != nil {
+		if err := h.authz.RequirePermission(operatorID, rm, room.PermModerate); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	actor := h.system.DisplayName(operatorID)
+
+	var changes []roomChange
+	var flagged []func() // moderation flags, recorded once the update is saved
+	if u.Name != nil && *u.Name != rm.Name {
+		if *u.Name == "" || utf8.RuneCountInString(*u.Name) > maxRoomNameLength {
+			return nil, nil, xerror.New(xerror.CodeInvalidParams, "name must be between 1 and 100 characters")
+		}
+		screened, err := h.moderation.Screen(*u.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		flagged = append(flagged, func() { h.moderation.Flag(screened, operatorID, moderation.TargetRoomName, rm.ID) })
+		rm.Name = screened.Text
+		changes = append(changes, roomChange{"name", rm.Name, fmt.Sprintf("%s renamed the group to %q", actor, rm.Name)})
+	}
+	if u.Avatar != nil && *u.Avatar != rm.Avatar {
+		if utf8.RuneCountInString(*u.Avatar) > 255 {
+			return nil, nil, xerror.New(xerror.CodeInvalidParams, "avatar must be at most 255 characters")
+		}
+		rm.Avatar = *u.Avatar
+		changes = append(changes, roomChange{"avatar", rm.Avatar, fmt.Sprintf("%s changed the group avatar", actor)})
+	}
+	if u.Description != nil && *u.Description != rm.Description {
+		if utf8.RuneCountInString(*u.Description) > maxRoomDescriptionLength {
+			return nil, nil, xerror.New(xerror.CodeInvalidParams, "description must be at most 500 characters")
+		}
+		screened, err := h.moderation.Screen(*u.Description)
+		if err != nil {
+			return nil, nil, err
+		}
+		flagged = append(flagged, func() { h.moderation.Flag(screened, operatorID, moderation.TargetRoomDescription, rm.ID) })
+		rm.Description = screened.Text
+		if rm.Description == "" {
+			changes = append(changes, roomChange{"description", rm.Description, fmt.Sprintf("%s removed the group description", actor)})
+		} else {
+			changes = append(changes, roomChange{"description", rm.Description, fmt.Sprintf("%s changed the group description", actor)})
+		}
+	}
+	if u.SlowMode != nil && *u.SlowMode != rm.SlowMode {
+		if *u.SlowMode < 0 || *u.SlowMode > maxSlowMode {
+			return nil, nil, xerror.New(xerror.CodeInvalidParams, "slow mode must be between 0 and 3600 seconds")
+		}
+		rm.SlowMode = *u.SlowMode
+		if rm.SlowMode == 0 {
+			changes = append(changes, roomChange{"slow_mode", rm.SlowMode, fmt.Sprintf("%s turned off slow mode", actor)})
+		} else {
+			changes = append(changes, roomChange{"slow_mode", rm.SlowMode, fmt.Sprintf("%s set slow mode to %d seconds", actor, rm.SlowMode)})
+		}
+	}
+	if u.MuteAll != nil && *u.MuteAll != rm.MuteAll {
+		rm.MuteAll = *u.MuteAll
+		if rm.MuteAll {
+			changes = append(changes, roomChange{"mute_all", rm.MuteAll, fmt.Sprintf("%s muted all members", actor)})
+		} else {
+			changes = append(changes, roomChange{"mute_all", rm.MuteAll, fmt.Sprintf("%s unmuted all members", actor)})
+		}
+	}
+	if u.JoinApproval != nil && *u.JoinApproval != rm.JoinApproval {
+		if !rm.Type.IsPublic() {
+			return nil, nil, xerror.New(xerror.CodeInvalidParams, "join approval applies to public channels only")
+		}
+		rm.JoinApproval = *u.JoinApproval
+		if rm.JoinApproval {
+			changes = append(changes, roomChange{"join_approval", rm.JoinApproval, fmt.Sprintf("%s made joining require approval", actor)})
+		} else {
+			changes = append(changes, roomChange{"join_approval", rm.JoinApproval, fmt.Sprintf("%s opened the channel to anyone", actor)})
+		}
+	}
+
+	if len(changes) == 0 {
+		return rm, nil, nil
+	}
+	if err := h.roomRepo.Update(rm); err != nil {
+		return nil, nil, xerror.New(xerror.CodeInternalError, "failed to update room")
+	}
+	for _, flag := range flagged {
+		flag()
+	}
+
+	var msgs []chat.Message
+	for _, change := range changes {
+		msgs = h.system.Post(msgs, roomID, chat.SystemPayload{
+			Event:   chat.SystemRoomUpdated,
+			ActorID: operatorID,
+			Changes: map[string]interface{}{change.field: change.value},
+		}, change.text)
+	}
+	return rm, msgs, nil
+}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/logger"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SystemMessageHandler records room events (membership changes, edits) in
+// the room's history as system messages. Commands return the messages
+// they recorded; the interface layer broadcasts them.
+type SystemMessageHandler struct {
+	messageRepo chat.Repository
+	userRepo    user.Repository
+}
+
+func NewSystemMessageHandler(messageRepo chat.Repository, userRepo user.Repository) *SystemMessageHandler {
+	return &SystemMessageHandler{messageRepo: messageRepo, userRepo: userRepo}
+}
+
+// Post stores a system message sent by payload.ActorID and appends it to
+// msgs. A failure is only logged: the event itself has happened.
+func (h *SystemMessageHandler) Post(msgs []chat.Message, roomID uint, payload chat.SystemPayload, text string) []chat.Message {
+	msg := &chat.Message{
+		RoomID:   roomID,
+		SenderID: payload.ActorID,
+		Content:  text,
+		Format:   chat.TextFormatPlain,
+		Type:     chat.MessageTypeSystem,
+		System:   &payload,
+	}
+	if err := h.messageRepo.Create(msg); err != nil {
+		logger.L.Error("failed to save system message", zap.Error(err), zap.Uint("room_id", roomID))
+		return msgs
+	}
+	// Reload for the sender
+	if saved, err := h.messageRepo.GetByID(msg.ID); err == nil {
+		msg = saved
+	}
+	return append(msgs, *msg)
+}
+
+// MemberJoined records userID joining on their own (invite, invitation,
+// approved request).
+func (h *SystemMessageHandler) MemberJoined(roomID uint, userID uint) []chat.Message {
+	return h.Post(nil, roomID, chat.SystemPayload{
+		Event:   chat.SystemMemberJoined,
+		ActorID: userID,
+		UserIDs: []uint{userID},
+	}, fmt.Sprintf("%s joined the group", h.DisplayName(userID)))
+}
+
+func (h *SystemMessageHandler) DisplayName(userID uint) string {
+	if u, err := h.userRepo.GetByID(userID); err == nil {
+		return u.DisplayName()
+	}
+	return fmt.Sprintf("User %d", userID)
+}
+
+func (h *SystemMessageHandler) DisplayNames(userIDs []uint) string {
+	names := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		names[i] = h.DisplayName(id)
+	}
+	return strings.Join(names, ", ")
+}
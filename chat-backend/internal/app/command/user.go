@@ -1,16 +1,18 @@
 package command
 
 import (
+	"chat-backend/internal/domain/moderation"
 	"chat-backend/internal/domain/user"
 	"chat-backend/pkg/xerror"
 )
 
 type UserHandler struct {
-	userRepo user.Repository
+	userRepo   user.Repository
+	moderation *ModerationHandler
 }
 
-func NewUserHandler(userRepo user.Repository) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo user.Repository, moderation *ModerationHandler) *UserHandler {
+	return &UserHandler{userRepo: userRepo, moderation: moderation}
 }
 
 func (h *UserHandler) GetProfile(userID uint) (*user.User, error) {
@@ -27,12 +29,34 @@ func (h *UserHandler) UpdateProfile(userID uint, nickname, avatar string) error
 		return xerror.New(xerror.CodeNotFound, "user not found")
 	}
 
-	u.Nickname = nickname
+	screened, err := h.moderation.Screen(nickname)
+	if err != nil {
+		return err
+	}
+
+	u.Nickname = screened.Text
 	u.Avatar = avatar
 
 	if err := h.userRepo.Update(u); err != nil {
 		return xerror.New(xerror.CodeInternalError, "failed to update profile")
 	}
+	h.moderation.Flag(screened, userID, moderation.TargetNickname, userID)
+	return nil
+}
+
+func (h *UserHandler) UpdatePrivacy(userID uint, policy user.GroupInvitePolicy) error {
+	if !policy.Valid() {
+		return xerror.New(xerror.CodeInvalidParams, "group_invite_policy must be everyone, friends or approval")
+	}
+	u, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return xerror.New(xerror.CodeNotFound, "user not found")
+	}
+
+	u.GroupInvitePolicy = policy
+	if err := h.userRepo.Update(u); err != nil {
+		return xerror.New(xerror.CodeInternalError, "failed to update privacy settings")
+	}
 	return nil
 }
 
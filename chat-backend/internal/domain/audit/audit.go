@@ -0,0 +1,24 @@
+package audit
+
+import "time"
+
+type Action string
+
+const (
+	ActionAccessDenied Action = "access_denied"
+)
+
+// Log is an append-only record of a security relevant event.
+type Log struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	UserID     uint      `gorm:"index;not null" json:"user_id"`
+	Action     Action    `gorm:"size:50;not null" json:"action"`
+	Resource   string    `gorm:"size:50" json:"resource"`
+	ResourceID uint      `json:"resource_id"`
+	Detail     string    `gorm:"size:255" json:"detail"`
+}
+
+type Repository interface {
+	Create(log *Log) error
+}
@@ -2,6 +2,8 @@ package chat
 
 import (
 	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/markdown"
+	"chat-backend/pkg/xerror"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,6 +15,37 @@ const (
 	MessageTypeText  MessageType = "text"
 	MessageTypeImage MessageType = "image"
 	MessageTypeFile  MessageType = "file"
+	// System messages record room events such as renames; only the server
+	// creates them, SenderID is the user who caused the event.
+	MessageTypeSystem MessageType = "system"
+)
+
+type SystemEvent string
+
+const (
+	SystemRoomCreated      SystemEvent = "room_created"
+	SystemRoomUpdated      SystemEvent = "room_updated"
+	SystemMemberJoined     SystemEvent = "member_joined"
+	SystemMemberLeft       SystemEvent = "member_left"
+	SystemMemberRemoved    SystemEvent = "member_removed"
+	SystemOwnerTransferred SystemEvent = "owner_transferred"
+)
+
+// SystemPayload is the structured form of a system message; Content holds
+// the rendered sentence for clients that don't interpret it.
+type SystemPayload struct {
+	Event   SystemEvent            `json:"event"`
+	ActorID uint                   `json:"actor_id"`
+	UserIDs []uint                 `json:"user_ids,omitempty"` // members the event is about
+	Changes map[string]interface{} `json:"changes,omitempty"`  // room_updated: field -> new value
+	Banned  bool                   `json:"banned,omitempty"`   // member_removed
+}
+
+type TextFormat string
+
+const (
+	TextFormatPlain    TextFormat = "plain"
+	TextFormatMarkdown TextFormat = "markdown"
 )
 
 type Message struct {
@@ -24,11 +57,14 @@ type Message struct {
 	SenderID  uint           `gorm:"index;not null" json:"sender_id"`
 	Sender    user.User      `gorm:"foreignKey:SenderID" json:"sender"`
 	Content   string         `gorm:"type:text" json:"content"`
+	Format    TextFormat     `gorm:"size:20;not null;default:'plain'" json:"format"`
+	PlainText string         `gorm:"type:text" json:"-"` // rendering of markdown content
 	Type      MessageType    `gorm:"size:20;not null;default:'text'" json:"type"`
 	FileURL   string         `json:"file_url,omitempty"`
 	FileName  string         `json:"file_name,omitempty"`
 	FileSize  int64          `json:"file_size,omitempty"`
 	Mentions  []uint         `gorm:"serializer:json" json:"mentions,omitempty"`
+	System    *SystemPayload `gorm:"type:text;serializer:json" json:"system,omitempty"`
 }
 
 type MessageResponse struct {
@@ -37,11 +73,13 @@ type MessageResponse struct {
 	RoomID    uint                `json:"room_id"`
 	Sender    user.UserResponse   `json:"sender"`
 	Content   string              `json:"content"`
+	Format    TextFormat          `json:"format"`
 	Type      MessageType         `json:"type"`
 	FileURL   string              `json:"file_url,omitempty"`
 	FileName  string              `json:"file_name,omitempty"`
 	FileSize  int64               `json:"file_size,omitempty"`
 	Mentions  []uint              `json:"mentions,omitempty"`
+	System    *SystemPayload      `json:"system,omitempty"`
 }
 
 func (m *Message) ToResponse() MessageResponse {
@@ -51,17 +89,53 @@ func (m *Message) ToResponse() MessageResponse {
 		RoomID:    m.RoomID,
 		Sender:    m.Sender.ToResponse(),
 		Content:   m.Content,
+		Format:    m.Format,
 		Type:      m.Type,
 		FileURL:   m.FileURL,
 		FileName:  m.FileName,
 		FileSize:  m.FileSize,
 		Mentions:  m.Mentions,
+		System:    m.System,
+	}
+}
+
+// Render validates the content against its text format and fills PlainText.
+// Unknown formats fall back to plain. Raw HTML is rejected in every format;
+// clients must still escape content, which may contain "<" as text.
+func (m *Message) Render() error {
+	if m.Format != TextFormatMarkdown {
+		m.Format = TextFormatPlain
+		m.PlainText = ""
+		if err := markdown.CheckHTML(m.Content); err != nil {
+			return xerror.New(xerror.CodeInvalidParams, err.Error())
+		}
+		return nil
+	}
+	plain, err := markdown.PlainText(m.Content)
+	if err != nil {
+		return xerror.New(xerror.CodeInvalidParams, err.Error())
+	}
+	m.PlainText = plain
+	return nil
+}
+
+// Preview returns the plain-text form of the message content.
+func (m *Message) Preview() string {
+	if m.Format == TextFormatMarkdown && m.PlainText != "" {
+		return m.PlainText
 	}
+	return m.Content
 }
 
 type Repository interface {
 	Create(message *Message) error
+	CreateBatch(messages []Message) error
 	GetByID(id uint) (*Message, error)
 	GetByRoomID(roomID uint, limit int, offset int) ([]Message, error)
+	Search(roomID uint, query string, limit int) ([]Message, error)
 	MarkAsRead(roomID uint, userID uint, lastReadMessageID uint) error
+	// Summaries returns the conversation-list data of roomIDs for userID
+	// in a constant number of queries, whatever the number of rooms. The
+	// read status of the rooms in largeRoomIDs only has userID's receipt.
+	Summaries(userID uint, roomIDs []uint, largeRoomIDs []uint) (map[uint]*RoomSummary, error)
 }
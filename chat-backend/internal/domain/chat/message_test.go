@@ -0,0 +1,36 @@
+package chat
+
+import "testing"
+
+func TestRenderRejectsHTML(t *testing.T) {
+	for _, format := range []TextFormat{TextFormatPlain, TextFormatMarkdown, ""} {
+		for _, content := range []string{
+			"<script>alert(1)</script>",
+			"hello <img src=x onerror=alert(1)>",
+			"`<script>alert(1)</script>`",
+		} {
+			m := &Message{Content: content, Format: format}
+			if err := m.Render(); err == nil {
+				t.Errorf("Render(%q, format %q) accepted raw HTML", content, format)
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := &Message{Content: "a < b **bold**", Format: TextFormatMarkdown}
+	if err := m.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if m.PlainText != "a < b bold" {
+		t.Errorf("PlainText = %q", m.PlainText)
+	}
+
+	m = &Message{Content: "a < b **bold**", Format: "html"}
+	if err := m.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != TextFormatPlain || m.PlainText != "" {
+		t.Errorf("unknown format rendered as %q with plain text %q", m.Format, m.PlainText)
+	}
+}
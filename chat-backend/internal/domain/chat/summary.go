@@ -0,0 +1,38 @@
+package chat
+
+import "time"
+
+// LastMessage is the conversation-list snapshot of a room's latest message.
+// Content is the plain-text preview.
+type LastMessage struct {
+	ID        uint        `json:"id"`
+	Content   string      `json:"content"`
+	Format    TextFormat  `json:"format"`
+	Type      MessageType `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	SenderID  uint        `json:"sender_id"`
+	Sender    struct {
+		Username string `json:"username"`
+		Nickname string `json:"nickname"`
+	} `json:"sender"`
+}
+
+// Snapshot returns the list snapshot of m, without sender names.
+func (m *Message) Snapshot() *LastMessage {
+	return &LastMessage{
+		ID:        m.ID,
+		Content:   m.Preview(),
+		Format:    m.Format,
+		Type:      m.Type,
+		CreatedAt: m.CreatedAt,
+		SenderID:  m.SenderID,
+	}
+}
+
+// RoomSummary is what the conversation list shows for a room besides the
+// room itself.
+type RoomSummary struct {
+	LastMessage *LastMessage
+	UnreadCount int64
+	ReadStatus  []ReadReceipt
+}
@@ -0,0 +1,40 @@
+package moderation
+
+import (
+	"chat-backend/pkg/sensitive"
+	"time"
+)
+
+type TargetType string
+
+const (
+	TargetMessage         TargetType = "message"
+	TargetRoomName        TargetType = "room_name"
+	TargetNickname        TargetType = "nickname"
+	TargetAnnouncement    TargetType = "announcement"
+	TargetRoomDescription TargetType = "room_description"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+// Review is content that matched a "review" word list and awaits a moderator.
+type Review struct {
+	ID         uint            `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UserID     uint            `gorm:"index;not null" json:"user_id"`
+	TargetType TargetType      `gorm:"size:20;not null" json:"target_type"`
+	TargetID   uint            `gorm:"index" json:"target_id"`
+	Content    string          `gorm:"type:text" json:"content"`
+	Hits       []sensitive.Hit `gorm:"serializer:json" json:"hits"`
+	Status     ReviewStatus    `gorm:"size:20;not null;default:'pending'" json:"status"`
+}
+
+type Repository interface {
+	Create(review *Review) error
+}
@@ -0,0 +1,76 @@
+package room
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/markdown"
+	"chat-backend/pkg/xerror"
+	"time"
+)
+
+// Announcement is a group's notice board: a single text kept by the admins,
+// separate from the message stream. UpdatedAt is the last edit; members
+// acknowledge the current version.
+type Announcement struct {
+	RoomID    uint            `gorm:"primaryKey" json:"room_id"`
+	AuthorID  uint            `gorm:"not null" json:"author_id"`
+	Author    user.User       `gorm:"foreignKey:AuthorID" json:"author"`
+	Content   string          `gorm:"type:text" json:"content"`
+	Format    chat.TextFormat `gorm:"size:20;not null;default:'plain'" json:"format"`
+	PlainText string          `gorm:"type:text" json:"plain_text"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type AnnouncementResponse struct {
+	Content      string            `json:"content"`
+	Format       chat.TextFormat   `json:"format"`
+	Author       user.UserResponse `json:"author"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	Acknowledged bool              `json:"acknowledged"`
+}
+
+func (a *Announcement) ToResponse() *AnnouncementResponse {
+	return &AnnouncementResponse{
+		Content:   a.Content,
+		Format:    a.Format,
+		Author:    a.Author.ToResponse(),
+		CreatedAt: a.CreatedAt,
+		UpdatedAt: a.UpdatedAt,
+	}
+}
+
+// Render validates the content against its text format and fills PlainText,
+// the same way chat messages are rendered.
+func (a *Announcement) Render() error {
+	if a.Format != chat.TextFormatMarkdown {
+		a.Format = chat.TextFormatPlain
+		if err := markdown.CheckHTML(a.Content); err != nil {
+			return xerror.New(xerror.CodeInvalidParams, err.Error())
+		}
+		a.PlainText = a.Content
+		return nil
+	}
+	plain, err := markdown.PlainText(a.Content)
+	if err != nil {
+		return xerror.New(xerror.CodeInvalidParams, err.Error())
+	}
+	a.PlainText = plain
+	return nil
+}
+
+// AnnouncementAcknowledged reports whether userID has acknowledged the
+// current version of the announcement. Rooms without one count as
+// acknowledged.
+func (r *Room) AnnouncementAcknowledged(userID uint) bool {
+	if r.Announcement == nil {
+		return true
+	}
+	for _, m := range r.Memberships {
+		if m.UserID == userID {
+			return m.AnnouncementAckAt != nil && !m.AnnouncementAckAt.Before(r.Announcement.UpdatedAt)
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package room
+
+import "time"
+
+// Ban keeps a user out of a group: they are removed and cannot rejoin
+// through invites, join requests or invitations until unbanned.
+type Ban struct {
+	RoomID    uint      `gorm:"primaryKey" json:"room_id"`
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	BannedBy  uint      `gorm:"not null" json:"banned_by"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BanRepository interface {
+	Create(ban *Ban) error
+	Delete(roomID uint, userID uint) error
+	IsBanned(roomID uint, userID uint) (bool, error)
+	ListByRoom(roomID uint) ([]Ban, error)
+}
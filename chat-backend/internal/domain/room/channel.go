@@ -0,0 +1,28 @@
+package room
+
+import "time"
+
+// ChannelInfo is a channel as listed in discovery, before joining.
+type ChannelInfo struct {
+	ID           uint      `json:"id"`
+	Type         RoomType  `json:"type"`
+	Name         string    `json:"name"`
+	Avatar       string    `json:"avatar"`
+	Description  string    `json:"description"`
+	MemberCount  int64     `json:"member_count"`
+	JoinApproval bool      `json:"join_approval"` // joining files a request, see Room.JoinApproval
+	CreatedAt    time.Time `json:"created_at"`
+	Joined       bool      `json:"joined" gorm:"-"`
+}
+
+// MembershipChannelPrefix is the Redis channel prefix, followed by the room
+// id, on which membership changes are announced to every instance.
+const MembershipChannelPrefix = "membership:"
+
+// MembershipChange is a member joining or leaving a room; UserID 0 means the
+// room was deleted.
+type MembershipChange struct {
+	RoomID uint `json:"room_id"`
+	UserID uint `json:"user_id"`
+	Joined bool `json:"joined"`
+}
@@ -0,0 +1,32 @@
+package room
+
+import "time"
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationDeclined InvitationStatus = "declined"
+)
+
+// Invitation asks a user to join a group. It is created instead of adding
+// the user directly when their GroupInvitePolicy requires consent.
+type Invitation struct {
+	ID          uint             `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	RoomID      uint             `gorm:"index;not null" json:"room_id"`
+	InviterID   uint             `gorm:"not null" json:"inviter_id"`
+	InviteeID   uint             `gorm:"index;not null" json:"invitee_id"`
+	Status      InvitationStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	RespondedAt *time.Time       `json:"responded_at"`
+}
+
+type InvitationRepository interface {
+	Create(invitation *Invitation) error
+	GetByID(id uint) (*Invitation, error)
+	GetPending(roomID uint, inviteeID uint) (*Invitation, error)
+	ListPending(inviteeID uint) ([]Invitation, error)
+	Update(invitation *Invitation) error
+}
@@ -0,0 +1,38 @@
+package room
+
+import "time"
+
+// Invite is a shareable link token granting entry to a group.
+type Invite struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RoomID           uint       `gorm:"index;not null" json:"room_id"`
+	CreatorID        uint       `gorm:"not null" json:"creator_id"`
+	Token            string     `gorm:"size:64;uniqueIndex;not null" json:"token"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	MaxUses          int        `gorm:"default:0" json:"max_uses"` // 0 is unlimited
+	Uses             int        `gorm:"default:0" json:"uses"`
+	RequiresApproval bool       `gorm:"default:false" json:"requires_approval"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+}
+
+// Usable reports whether the invite can still be redeemed at now.
+func (i *Invite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+type InviteRepository interface {
+	Create(invite *Invite) error
+	GetByID(id uint) (*Invite, error)
+	GetByToken(token string) (*Invite, error)
+	ListByRoom(roomID uint) ([]Invite, error)
+	Revoke(id uint) error
+	// Consume counts one use, failing if the invite is no longer usable
+	Consume(id uint) (bool, error)
+}
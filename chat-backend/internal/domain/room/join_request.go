@@ -0,0 +1,33 @@
+package room
+
+import "time"
+
+type JoinRequestStatus string
+
+const (
+	JoinRequestPending  JoinRequestStatus = "pending"
+	JoinRequestApproved JoinRequestStatus = "approved"
+	JoinRequestRejected JoinRequestStatus = "rejected"
+)
+
+// JoinRequest is a user's request to enter a group that requires approval.
+type JoinRequest struct {
+	ID         uint              `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	RoomID     uint              `gorm:"index;not null" json:"room_id"`
+	UserID     uint              `gorm:"index;not null" json:"user_id"`
+	InviteID   *uint             `json:"invite_id"`
+	Note       string            `gorm:"size:500" json:"note"`
+	Status     JoinRequestStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	ReviewerID *uint             `json:"reviewer_id"`
+	ReviewedAt *time.Time        `json:"reviewed_at"`
+}
+
+type JoinRequestRepository interface {
+	Create(req *JoinRequest) error
+	GetByID(id uint) (*JoinRequest, error)
+	GetPending(roomID uint, userID uint) (*JoinRequest, error)
+	ListByRoom(roomID uint, status JoinRequestStatus) ([]JoinRequest, error)
+	Update(req *JoinRequest) error
+}
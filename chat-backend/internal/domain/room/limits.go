@@ -0,0 +1,33 @@
+package room
+
+// Limits caps room sizes per type and sets where large-group mode starts.
+// Large groups keep working like any other, minus the features whose cost
+// grows with every member: relayed read receipts, typing indicators and full
+// member lists, which are paged instead.
+type Limits struct {
+	// MemberLimits is the most members a room of each type may have; 0 or
+	// missing means unlimited
+	MemberLimits        map[RoomType]int `mapstructure:"member_limits"`
+	LargeGroupThreshold int              `mapstructure:"large_group_threshold"`
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MemberLimits: map[RoomType]int{
+			RoomTypePrivate: 2,
+			RoomTypeGroup:   3000,
+			RoomTypeChannel: 50000,
+		},
+		LargeGroupThreshold: 500,
+	}
+}
+
+func (l Limits) MemberLimit(t RoomType) int {
+	return l.MemberLimits[t]
+}
+
+// IsLarge reports whether a room with memberCount members runs in
+// large-group mode. Broadcast channels always do.
+func (l Limits) IsLarge(t RoomType, memberCount int64) bool {
+	return t == RoomTypeBroadcast || (l.LargeGroupThreshold > 0 && memberCount >= int64(l.LargeGroupThreshold))
+}
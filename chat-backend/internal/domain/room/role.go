@@ -0,0 +1,73 @@
+package room
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+// Permission is a group operation restricted by role.
+type Permission string
+
+const (
+	PermAddMembers    Permission = "add_members"
+	PermRemoveMembers Permission = "remove_members"
+	PermEditInfo      Permission = "edit_info"
+	PermPin           Permission = "pin"
+	PermModerate      Permission = "moderate" // slow mode, mutes, bans
+	PermDissolve      Permission = "dissolve"
+	PermAppointAdmins Permission = "appoint_admins"
+	PermTransfer      Permission = "transfer_ownership"
+)
+
+var permissions = map[Role]map[Permission]bool{
+	RoleOwner: {
+		PermAddMembers:    true,
+		PermRemoveMembers: true,
+		PermEditInfo:      true,
+		PermPin:           true,
+		PermModerate:      true,
+		PermDissolve:      true,
+		PermAppointAdmins: true,
+		PermTransfer:      true,
+	},
+	RoleAdmin: {
+		PermAddMembers:    true,
+		PermRemoveMembers: true,
+		PermEditInfo:      true,
+		PermPin:           true,
+		PermModerate:      true,
+	},
+	RoleMember: {},
+}
+
+func (r Role) Valid() bool {
+	_, ok := permissions[r]
+	return ok
+}
+
+// Can reports whether the role grants p. The empty role (not a member)
+// grants nothing.
+func (r Role) Can(p Permission) bool {
+	return permissions[r][p]
+}
+
+// Outranks reports whether r may act on a member holding other, e.g. an
+// admin may remove members but not other admins.
+func (r Role) Outranks(other Role) bool {
+	return r.rank() > other.rank()
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
@@ -13,8 +13,29 @@ type RoomType string
 const (
 	RoomTypePrivate RoomType = "private"
 	RoomTypeGroup   RoomType = "group"
+	// Channels are groups anyone can find and join
+	RoomTypeChannel RoomType = "channel"
+	// Broadcast channels are channels where only the owner and admins post,
+	// to audiences of tens of thousands
+	RoomTypeBroadcast RoomType = "broadcast"
 )
 
+func (t RoomType) Valid() bool {
+	return t == RoomTypePrivate || t.IsGroup()
+}
+
+// IsGroup reports whether rooms of this type have an owner and admins
+// managing their members: groups and both kinds of channel.
+func (t RoomType) IsGroup() bool {
+	return t == RoomTypeGroup || t.IsPublic()
+}
+
+// IsPublic reports whether rooms of this type are listed in discovery and
+// open to anyone.
+func (t RoomType) IsPublic() bool {
+	return t == RoomTypeChannel || t == RoomTypeBroadcast
+}
+
 type Room struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -24,27 +45,67 @@ type Room struct {
 	Avatar    string         `gorm:"size:255" json:"avatar"`
 	Type      RoomType       `gorm:"size:20;not null;default:'private'" json:"type"`
 	CreatorID uint           `json:"creator_id"`
-	Members   []user.User    `gorm:"many2many:room_members;" json:"members"`
+	SlowMode  int            `gorm:"default:0" json:"slow_mode"`    // seconds between messages per member, 0 disables
+	MuteAll   bool           `gorm:"default:false" json:"mute_all"` // only owner and admins may speak
+	// JoinApproval makes a public channel take join requests instead of
+	// letting anyone in; it stays listed in discovery
+	JoinApproval bool        `gorm:"default:false" json:"join_approval"`
+	Members      []user.User `gorm:"many2many:room_members;" json:"members"`
+	// Memberships are room_members rows: the owner's and admins' always,
+	// anyone else's only once loaded with Repository.LoadMemberships (room
+	// lists include the listing user's own)
+	Memberships  []RoomMember  `gorm:"foreignKey:RoomID" json:"memberships"`
+	Announcement *Announcement `gorm:"foreignKey:RoomID" json:"announcement"`
+	Description  string        `gorm:"size:500" json:"description"` // group "about" text
+	// MemberCount and Large are set by the repository; Members is only
+	// loaded for rooms that are not Large
+	MemberCount int64 `gorm:"-" json:"member_count"`
+	Large       bool  `gorm:"-" json:"large"`
 }
 
 type RoomMember struct {
-	RoomID   uint      `gorm:"primaryKey" json:"room_id"`
+	RoomID   uint      `gorm:"primaryKey;index:idx_room_members_hidden,priority:1" json:"room_id"`
 	UserID   uint      `gorm:"primaryKey" json:"user_id"`
+	Role     Role      `gorm:"size:20;not null;default:'member'" json:"role"`
 	JoinedAt time.Time `json:"joined_at"`
-	IsHidden bool      `gorm:"default:false" json:"is_hidden"`
+	IsHidden bool      `gorm:"default:false;index:idx_room_members_hidden,priority:2" json:"is_hidden"`
+	// MutedUntil silences the member until the given time
+	MutedUntil *time.Time `json:"muted_until"`
+	// AnnouncementAckAt is when the member last acknowledged the announcement
+	AnnouncementAckAt *time.Time `json:"announcement_ack_at"`
+	// Settings are the member's own conversation preferences
+	Settings MemberSettings `gorm:"embedded" json:"settings"`
+}
+
+// MemberInfo is one entry of a room's paged member list.
+type MemberInfo struct {
+	User     user.UserResponse `json:"user"`
+	Role     Role              `json:"role"`
+	JoinedAt time.Time         `json:"joined_at"`
 }
 
 type RoomResponse struct {
-	ID          uint                `json:"id"`
-	CreatedAt   time.Time           `json:"created_at"`
-	Name        string              `json:"name"`
-	Avatar      string              `json:"avatar"`
-	Type        RoomType            `json:"type"`
-	CreatorID   uint                `json:"creator_id"`
-	Members     []user.UserResponse `json:"members"`
-	ReadStatus  []chat.ReadReceipt  `json:"read_status"`
-	UnreadCount int64               `json:"unread_count"`
-	LastMessage interface{}         `json:"last_message"`
+	ID           uint                `json:"id"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Name         string              `json:"name"`
+	Avatar       string              `json:"avatar"`
+	Description  string              `json:"description"`
+	Type         RoomType            `json:"type"`
+	CreatorID    uint                `json:"creator_id"`
+	SlowMode     int                 `json:"slow_mode"`
+	MuteAll      bool                `json:"mute_all"`
+	JoinApproval bool                `json:"join_approval"`
+	Members      []user.UserResponse `json:"members"` // empty for large groups, see MemberCount
+	MemberCount  int64               `json:"member_count"`
+	Large        bool                `json:"large"`
+	MemberRoles  map[uint]Role       `json:"member_roles"` // owner and admins only
+	// Announcement.Acknowledged and Settings (the viewer's own) are filled
+	// in per viewer by the handlers
+	Announcement *AnnouncementResponse `json:"announcement"`
+	Settings     *MemberSettings       `json:"settings,omitempty"`
+	ReadStatus   []chat.ReadReceipt    `json:"read_status"`
+	UnreadCount  int64                 `json:"unread_count"`
+	LastMessage  interface{}           `json:"last_message"`
 }
 
 func (r *Room) ToResponse() RoomResponse {
@@ -53,25 +114,126 @@ func (r *Room) ToResponse() RoomResponse {
 		memberResponses[i] = member.ToResponse()
 	}
 
-	return RoomResponse{
-		ID:        r.ID,
-		CreatedAt: r.CreatedAt,
-		Name:      r.Name,
-		Avatar:    r.Avatar,
-		Type:      r.Type,
-		CreatorID: r.CreatorID,
-		Members:   memberResponses,
+	memberRoles := make(map[uint]Role)
+	for _, m := range r.Memberships {
+		if m.Role == RoleOwner || m.Role == RoleAdmin {
+			memberRoles[m.UserID] = m.Role
+		}
+	}
+
+	resp := RoomResponse{
+		ID:           r.ID,
+		CreatedAt:    r.CreatedAt,
+		Name:         r.Name,
+		Avatar:       r.Avatar,
+		Description:  r.Description,
+		Type:         r.Type,
+		CreatorID:    r.CreatorID,
+		SlowMode:     r.SlowMode,
+		MuteAll:      r.MuteAll,
+		JoinApproval: r.JoinApproval,
+		Members:      memberResponses,
+		MemberCount:  r.MemberCount,
+		Large:        r.Large,
+		MemberRoles:  memberRoles,
+	}
+	if r.Announcement != nil {
+		resp.Announcement = r.Announcement.ToResponse()
+	}
+	return resp
+}
+
+// Admins lists the owner and admins, who handle requests to join.
+func (r *Room) Admins() []uint {
+	var ids []uint
+	for _, m := range r.Memberships {
+		if m.Role == RoleOwner || m.Role == RoleAdmin {
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids
+}
+
+// MutedUntil returns when userID's mute ends, or nil if they may speak.
+// Room-wide mute (MuteAll) is not reflected here. userID's membership must
+// be loaded.
+func (r *Room) MutedUntil(userID uint, now time.Time) *time.Time {
+	for _, m := range r.Memberships {
+		if m.UserID == userID && m.MutedUntil != nil && m.MutedUntil.After(now) {
+			return m.MutedUntil
+		}
+	}
+	return nil
+}
+
+// RoleOf returns userID's role, or "" if they are not a member. Unless
+// userID is the owner or an admin, their membership must be loaded with
+// Repository.LoadMemberships first.
+func (r *Room) RoleOf(userID uint) Role {
+	for _, m := range r.Memberships {
+		if m.UserID == userID {
+			if m.Role == "" {
+				return RoleMember
+			}
+			return m.Role
+		}
 	}
+	return ""
 }
 
 type Repository interface {
 	Create(room *Room) error
 	GetByID(id uint) (*Room, error)
-	GetByUserID(userID uint) ([]Room, error)
+	// GetByUserID lists userID's visible rooms, pinned first; archived
+	// selects the archive instead of the main list.
+	GetByUserID(userID uint, archived bool) ([]Room, error)
+	// GetForUser loads the rooms among roomIDs that userID is a member of,
+	// hidden and archived ones included.
+	GetForUser(userID uint, roomIDs []uint) ([]Room, error)
 	GetPrivateRoomBetweenUsers(userID1, userID2 uint) (*Room, error)
 	Update(room *Room) error
 	Delete(id uint) error
 	AddMember(roomID uint, userID uint) error
 	RemoveMember(roomID uint, userID uint) error
+	IsMember(roomID uint, userID uint) (bool, error)
+	MemberCount(roomID uint) (int64, error)
+	// MemberIDs lists every member of the room
+	MemberIDs(roomID uint) ([]uint, error)
+	// LoadMemberships adds the memberships of userIDs to rm.Memberships;
+	// users who are not members are skipped.
+	LoadMemberships(rm *Room, userIDs ...uint) error
+	// NotifyMutedMembers returns the memberships whose notification settings
+	// mute the room, including mutes that may have run out since.
+	NotifyMutedMembers(roomID uint) ([]RoomMember, error)
+	// Successor picks who inherits a group when its owner leaves: the
+	// longest-standing admin, otherwise the longest-standing member. It
+	// reports false when the owner is the only member.
+	Successor(roomID uint, ownerID uint) (uint, bool, error)
 	SetHidden(roomID uint, userID uint, hidden bool) error
+	// UnhideForAll shows the room again to every member who hid it and
+	// returns who they were.
+	UnhideForAll(roomID uint) ([]uint, error)
+	SetRole(roomID uint, userID uint, role Role) error
+	// TransferOwnership makes to the owner (and creator) of the room; the
+	// previous owner becomes an admin.
+	TransferOwnership(roomID uint, from uint, to uint) error
+	SetMutedUntil(roomID uint, userID uint, until *time.Time) error
+	// SetAnnouncement creates or replaces the room's announcement
+	SetAnnouncement(a *Announcement) error
+	DeleteAnnouncement(roomID uint) error
+	AcknowledgeAnnouncement(roomID uint, userID uint, at time.Time) error
+	UpdateSettings(roomID uint, userID uint, settings MemberSettings) error
+	// ListMembers pages through a room's members, owner and admins first
+	ListMembers(roomID uint, limit int, offset int) ([]MemberInfo, error)
+	// SearchChannels lists public rooms whose name or description contains
+	// query, largest first.
+	SearchChannels(query string, limit int, offset int) ([]ChannelInfo, error)
+	// TypeOf returns the type of a room, which never changes
+	TypeOf(roomID uint) (RoomType, error)
+	// RoomIDsByType lists the rooms of type t userID is a member of
+	RoomIDsByType(userID uint, t RoomType) ([]uint, error)
+	// Changes returns the current version of userID's room list and the
+	// rooms changed after since. complete is false when since predates the
+	// recorded changes and the whole list must be sent instead.
+	Changes(userID uint, since uint64) (version uint64, roomIDs []uint, complete bool, err error)
 }
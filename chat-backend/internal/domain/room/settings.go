@@ -0,0 +1,42 @@
+package room
+
+import "time"
+
+// MemberSettings are a member's private preferences for a conversation.
+// They are stored on the room_members row and only shown to that member.
+type MemberSettings struct {
+	// NotifyMuted silences notifications, until NotifyMutedUntil if set
+	NotifyMuted      bool       `gorm:"default:false" json:"notify_muted"`
+	NotifyMutedUntil *time.Time `json:"notify_muted_until"`
+	// PinOrder keeps the room at the top of the list; 0 is unpinned,
+	// pinned rooms sort by ascending order
+	PinOrder int    `gorm:"default:0" json:"pin_order"`
+	Alias    string `gorm:"size:100" json:"alias"`
+	Archived bool   `gorm:"default:false" json:"archived"`
+}
+
+// NotificationsMuted reports whether the mute is in effect at now.
+func (s MemberSettings) NotificationsMuted(now time.Time) bool {
+	return s.NotifyMuted && (s.NotifyMutedUntil == nil || s.NotifyMutedUntil.After(now))
+}
+
+// SettingsOf returns userID's settings for the room, zero if they are not
+// a member.
+func (r *Room) SettingsOf(userID uint) MemberSettings {
+	for _, m := range r.Memberships {
+		if m.UserID == userID {
+			return m.Settings
+		}
+	}
+	return MemberSettings{}
+}
+
+// HiddenFor reports whether userID has hidden the room from their list.
+func (r *Room) HiddenFor(userID uint) bool {
+	for _, m := range r.Memberships {
+		if m.UserID == userID {
+			return m.IsHidden
+		}
+	}
+	return false
+}
@@ -18,6 +18,37 @@ type User struct {
 	Avatar    string         `json:"avatar"`
 	Bio       string         `json:"bio"`
 	Status    string         `gorm:"default:'offline'" json:"status"`
+	// GroupInvitePolicy decides who may add this user to a group directly;
+	// everyone else sends an invitation
+	GroupInvitePolicy GroupInvitePolicy `gorm:"size:20;not null;default:'friends'" json:"group_invite_policy"`
+}
+
+type GroupInvitePolicy string
+
+const (
+	GroupInviteEveryone GroupInvitePolicy = "everyone"
+	GroupInviteFriends  GroupInvitePolicy = "friends"
+	GroupInviteApproval GroupInvitePolicy = "approval"
+)
+
+func (p GroupInvitePolicy) Valid() bool {
+	return p == GroupInviteEveryone || p == GroupInviteFriends || p == GroupInviteApproval
+}
+
+// InvitePolicy returns the user's policy, defaulting to friends.
+func (u *User) InvitePolicy() GroupInvitePolicy {
+	if !u.GroupInvitePolicy.Valid() {
+		return GroupInviteFriends
+	}
+	return u.GroupInvitePolicy
+}
+
+// DisplayName is the nickname, or the username for users without one.
+func (u *User) DisplayName() string {
+	if u.Nickname != "" {
+		return u.Nickname
+	}
+	return u.Username
 }
 
 type UserResponse struct {
@@ -29,6 +60,8 @@ type UserResponse struct {
 	Bio          string `json:"bio"`
 	Status       string `json:"status"`
 	FriendStatus string `json:"friend_status,omitempty"` // "pending", "accepted", or empty
+	// Only set on the user's own profile
+	GroupInvitePolicy GroupInvitePolicy `json:"group_invite_policy,omitempty"`
 }
 
 func (u *User) ToResponse() UserResponse {
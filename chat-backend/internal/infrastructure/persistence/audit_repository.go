@@ -0,0 +1,19 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/audit"
+
+	"gorm.io/gorm"
+)
+
+type auditRepo struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) audit.Repository {
+	return &auditRepo{db: db}
+}
+
+func (r *auditRepo) Create(log *audit.Log) error {
+	return r.db.Create(log).Error
+}
@@ -0,0 +1,39 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/room"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type banRepo struct {
+	db *gorm.DB
+}
+
+func NewBanRepository(db *gorm.DB) room.BanRepository {
+	return &banRepo{db: db}
+}
+
+// Create bans the user, replacing the reason of an existing ban.
+func (r *banRepo) Create(ban *room.Ban) error {
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"banned_by", "reason"}),
+	}).Create(ban).Error
+}
+
+func (r *banRepo) Delete(roomID uint, userID uint) error {
+	return r.db.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&room.Ban{}).Error
+}
+
+func (r *banRepo) IsBanned(roomID uint, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&room.Ban{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *banRepo) ListByRoom(roomID uint) ([]room.Ban, error) {
+	var bans []room.Ban
+	err := r.db.Where("room_id = ?", roomID).Order("created_at DESC").Find(&bans).Error
+	return bans, err
+}
@@ -0,0 +1,53 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/room"
+
+	"gorm.io/gorm"
+)
+
+type invitationRepo struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) room.InvitationRepository {
+	return &invitationRepo{db: db}
+}
+
+func (r *invitationRepo) Create(invitation *room.Invitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *invitationRepo) GetByID(id uint) (*room.Invitation, error) {
+	var invitation room.Invitation
+	if err := r.db.First(&invitation, id).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepo) GetPending(roomID uint, inviteeID uint) (*room.Invitation, error) {
+	var invitation room.Invitation
+	err := r.db.Where("room_id = ? AND invitee_id = ? AND status = ?", roomID, inviteeID, room.InvitationPending).
+		First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// ListPending returns the invitations awaiting inviteeID's answer, newest
+// first, skipping those for rooms that have since been deleted.
+func (r *invitationRepo) ListPending(inviteeID uint) ([]room.Invitation, error) {
+	var invitations []room.Invitation
+	err := r.db.Model(&room.Invitation{}).
+		Joins("JOIN rooms ON rooms.id = invitations.room_id AND rooms.deleted_at IS NULL").
+		Where("invitations.invitee_id = ? AND invitations.status = ?", inviteeID, room.InvitationPending).
+		Order("invitations.created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *invitationRepo) Update(invitation *room.Invitation) error {
+	return r.db.Save(invitation).Error
+}
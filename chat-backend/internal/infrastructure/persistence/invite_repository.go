@@ -0,0 +1,59 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/room"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type inviteRepo struct {
+	db *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) room.InviteRepository {
+	return &inviteRepo{db: db}
+}
+
+func (r *inviteRepo) Create(invite *room.Invite) error {
+	return r.db.Create(invite).Error
+}
+
+func (r *inviteRepo) GetByID(id uint) (*room.Invite, error) {
+	var invite room.Invite
+	if err := r.db.First(&invite, id).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *inviteRepo) GetByToken(token string) (*room.Invite, error) {
+	var invite room.Invite
+	if err := r.db.Where("token = ?", token).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *inviteRepo) ListByRoom(roomID uint) ([]room.Invite, error) {
+	var invites []room.Invite
+	err := r.db.Where("room_id = ?", roomID).Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+func (r *inviteRepo) Revoke(id uint) error {
+	return r.db.Model(&room.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Consume increments uses in one conditional UPDATE so that concurrent joins
+// cannot exceed max_uses.
+func (r *inviteRepo) Consume(id uint) (bool, error) {
+	res := r.db.Model(&room.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where("max_uses = 0 OR uses < max_uses").
+		Update("uses", gorm.Expr("uses + 1"))
+	return res.RowsAffected == 1, res.Error
+}
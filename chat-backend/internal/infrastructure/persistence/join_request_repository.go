@@ -0,0 +1,53 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/room"
+
+	"gorm.io/gorm"
+)
+
+type joinRequestRepo struct {
+	db *gorm.DB
+}
+
+func NewJoinRequestRepository(db *gorm.DB) room.JoinRequestRepository {
+	return &joinRequestRepo{db: db}
+}
+
+func (r *joinRequestRepo) Create(req *room.JoinRequest) error {
+	return r.db.Create(req).Error
+}
+
+func (r *joinRequestRepo) GetByID(id uint) (*room.JoinRequest, error) {
+	var req room.JoinRequest
+	if err := r.db.First(&req, id).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *joinRequestRepo) GetPending(roomID uint, userID uint) (*room.JoinRequest, error) {
+	var req room.JoinRequest
+	err := r.db.Where("room_id = ? AND user_id = ? AND status = ?", roomID, userID, room.JoinRequestPending).
+		First(&req).Error
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListByRoom returns the room's requests, oldest first. An empty status
+// lists all of them.
+func (r *joinRequestRepo) ListByRoom(roomID uint, status room.JoinRequestStatus) ([]room.JoinRequest, error) {
+	var reqs []room.JoinRequest
+	query := r.db.Where("room_id = ?", roomID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at ASC").Find(&reqs).Error
+	return reqs, err
+}
+
+func (r *joinRequestRepo) Update(req *room.JoinRequest) error {
+	return r.db.Save(req).Error
+}
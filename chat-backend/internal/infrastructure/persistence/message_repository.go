@@ -2,21 +2,39 @@ package persistence
 
 import (
 	"chat-backend/internal/domain/chat"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 type messageRepo struct {
-	db *gorm.DB
+	db  *gorm.DB
+	rdb *redis.Client
 }
 
-func NewMessageRepository(db *gorm.DB) chat.Repository {
-	return &messageRepo{db: db}
+func NewMessageRepository(db *gorm.DB, rdb *redis.Client) chat.Repository {
+	return &messageRepo{db: db, rdb: rdb}
 }
 
 func (r *messageRepo) Create(m *chat.Message) error {
-	return r.db.Create(m).Error
+	if err := r.db.Create(m).Error; err != nil {
+		return err
+	}
+	r.messageCreated(m)
+	return nil
+}
+
+func (r *messageRepo) CreateBatch(messages []chat.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	if err := r.db.CreateInBatches(messages, 500).Error; err != nil {
+		return err
+	}
+	r.forgetRooms(messages)
+	return nil
 }
 
 func (r *messageRepo) GetByID(id uint) (*chat.Message, error) {
@@ -36,6 +54,20 @@ func (r *messageRepo) GetByRoomID(roomID uint, limit int, offset int) ([]chat.Me
 	return messages, err
 }
 
+func (r *messageRepo) Search(roomID uint, query string, limit int) ([]chat.Message, error) {
+	var messages []chat.Message
+	like := "%" + escapeLike(query) + "%"
+	// Markdown messages are matched on their plain-text rendering
+	err := r.db.Where("room_id = ?", roomID).
+		Where("(format = ? AND plain_text LIKE ?) OR (format <> ? AND content LIKE ?)",
+			chat.TextFormatMarkdown, like, chat.TextFormatMarkdown, like).
+		Preload("Sender").
+		Order("created_at desc").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
 func (r *messageRepo) MarkAsRead(roomID uint, userID uint, lastReadMessageID uint) error {
 	var receipt chat.ReadReceipt
 	err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&receipt).Error
@@ -46,16 +78,30 @@ func (r *messageRepo) MarkAsRead(roomID uint, userID uint, lastReadMessageID uin
 			LastReadMessageID: lastReadMessageID,
 			ReadAt:            time.Now(),
 		}
-		return r.db.Create(&receipt).Error
+		if err := r.db.Create(&receipt).Error; err != nil {
+			return err
+		}
+		r.readUpTo(roomID, userID, lastReadMessageID)
+		return nil
 	} else if err != nil {
 		return err
 	}
 
 	if lastReadMessageID > receipt.LastReadMessageID {
-		return r.db.Model(&receipt).Updates(map[string]interface{}{
+		if err := r.db.Model(&receipt).Updates(map[string]interface{}{
 			"last_read_message_id": lastReadMessageID,
 			"read_at":              time.Now(),
-		}).Error
+		}).Error; err != nil {
+			return err
+		}
+		r.readUpTo(roomID, userID, lastReadMessageID)
 	}
 	return nil
 }
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,537 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/domain/user"
+	"chat-backend/pkg/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// The conversation list is served from two Redis structures kept up to date
+// on send and read:
+//
+//   - room:<id>:last  JSON snapshot of the room's latest message ("null" for
+//     rooms without messages)
+//   - unread:<user>   hash of room id -> unread count for that user
+//
+// Broadcast channels are too large to update every subscriber's counter on
+// each message. They keep one count instead:
+//
+//   - room:<id>:seq   number of messages in the room
+//   - unread:<user>   field "<id>:read" -> the room's seq as of the user's
+//     last read, so that their unread count is seq minus it
+//
+// Any of these may be missing (eviction, new member, partial read);
+// Summaries rebuilds what it lacks from MySQL in one grouped query per
+// structure. Counters are only incremented once they exist, so a rebuilt
+// count is never mixed with increments that predate it. A rebuild first
+// opens a pending list next to the counter (field "<id>:pending", key
+// room:<id>:seq:pending), in which sends that find no counter record their
+// message id. It then counts in MySQL, noting the highest message id the
+// count saw, and stores the count plus the pending ids above that id: a
+// message sent while the rebuild ran is counted once, by either.
+const (
+	lastMessageKeyFmt = "room:%d:last"
+	unreadKeyFmt      = "unread:%d"
+	roomSeqKeyFmt     = "room:%d:seq"
+	readSeqFieldFmt   = "%d:read"
+	pendingFieldFmt   = "%d:pending"
+	pendingSeqKeyFmt  = "room:%d:seq:pending"
+	lastMessageTTL    = 24 * time.Hour
+	unreadTTL         = 7 * 24 * time.Hour
+)
+
+// Replace the snapshot unless it already holds a newer message
+var setLastMessageScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur and cur ~= 'null' then
+	local ok, snap = pcall(cjson.decode, cur)
+	if ok and type(snap) == 'table' and tonumber(snap.id or 0) >= tonumber(ARGV[1]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+return 1
+`)
+
+// Bump the room's counter in each member hash that already tracks it, or
+// note the message (ARGV[3]) for a rebuild in progress
+var incrUnreadScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('HEXISTS', key, ARGV[1]) == 1 then
+		redis.call('HINCRBY', key, ARGV[1], 1)
+	else
+		local pending = redis.call('HGET', key, ARGV[2])
+		if pending then
+			redis.call('HSET', key, ARGV[2], pending .. ARGV[3] .. ',')
+		end
+	end
+end
+return 0
+`)
+
+// Bump the broadcast room's count, or note the message (ARGV[2]) for a
+// rebuild in progress, and, so that their own message does not count as
+// unread, the sender's read position if it exists
+var incrRoomSeqScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('INCR', KEYS[1])
+elseif redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('APPEND', KEYS[3], ARGV[2] .. ',')
+end
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+end
+return 0
+`)
+
+// Store a rebuilt unread counter (ARGV[1]) of ARGV[3] messages up to
+// message ARGV[4], plus the messages after it noted in the pending field
+// ARGV[2], unless another rebuild stored it first
+var setUnreadScript = redis.NewScript(`
+local pending = redis.call('HGET', KEYS[1], ARGV[2])
+redis.call('HDEL', KEYS[1], ARGV[2])
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+end
+local n = tonumber(ARGV[3])
+for id in string.gmatch(pending or '', '%d+') do
+	if tonumber(id) > tonumber(ARGV[4]) then
+		n = n + 1
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], n)
+return n
+`)
+
+// Same for a broadcast room's seq (KEYS[1]) and its pending key (KEYS[2]);
+// ARGV[3] is the TTL in seconds
+var setRoomSeqScript = redis.NewScript(`
+local pending = redis.call('GET', KEYS[2])
+redis.call('DEL', KEYS[2])
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return tonumber(redis.call('GET', KEYS[1]))
+end
+local n = tonumber(ARGV[1])
+for id in string.gmatch(pending or '', '%d+') do
+	if tonumber(id) > tonumber(ARGV[2]) then
+		n = n + 1
+	end
+end
+redis.call('SET', KEYS[1], n, 'EX', ARGV[3])
+return n
+`)
+
+func (r *messageRepo) messageCreated(m *chat.Message) {
+	ctx := context.Background()
+
+	if snap, err := json.Marshal(m.Snapshot()); err == nil {
+		key := fmt.Sprintf(lastMessageKeyFmt, m.RoomID)
+		if err := setLastMessageScript.Run(ctx, r.rdb, []string{key}, m.ID, snap, int(lastMessageTTL.Seconds())).Err(); err != nil {
+			// A stale snapshot is worse than none
+			r.rdb.Del(ctx, key)
+		}
+	}
+
+	if r.isBroadcast(m.RoomID) {
+		keys := []string{fmt.Sprintf(roomSeqKeyFmt, m.RoomID), fmt.Sprintf(unreadKeyFmt, m.SenderID), fmt.Sprintf(pendingSeqKeyFmt, m.RoomID)}
+		if err := incrRoomSeqScript.Run(ctx, r.rdb, keys, fmt.Sprintf(readSeqFieldFmt, m.RoomID), m.ID).Err(); err != nil {
+			r.rdb.Del(ctx, keys[0])
+		}
+		// Every subscriber's list shows the new last message
+		subscriberIDs, err := memberIDs(r.db, r.rdb, m.RoomID)
+		if err != nil {
+			logger.L.Warn("failed to load subscribers for conversation list change", zap.Error(err), zap.Uint("room_id", m.RoomID))
+			subscriberIDs = []uint{m.SenderID}
+		}
+		touchLists(r.rdb, m.RoomID, subscriberIDs...)
+		return
+	}
+
+	// The cached member set spares a query per message
+	ids, err := memberIDs(r.db, r.rdb, m.RoomID)
+	if err != nil {
+		logger.L.Warn("failed to load members for unread counters", zap.Error(err), zap.Uint("room_id", m.RoomID))
+		return
+	}
+	touchLists(r.rdb, m.RoomID, ids...)
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != m.SenderID {
+			keys = append(keys, fmt.Sprintf(unreadKeyFmt, id))
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := incrUnreadScript.Run(ctx, r.rdb, keys, m.RoomID, fmt.Sprintf(pendingFieldFmt, m.RoomID), m.ID).Err(); err != nil {
+		// Drop the counters so the next list rebuilds them
+		pipe := r.rdb.Pipeline()
+		for _, key := range keys {
+			pipe.HDel(ctx, key, strconv.FormatUint(uint64(m.RoomID), 10))
+		}
+		pipe.Exec(ctx)
+	}
+}
+
+// forgetRooms drops the snapshots of rooms that received messages in bulk,
+// such as imports; they are rebuilt on the next list.
+func (r *messageRepo) forgetRooms(messages []chat.Message) {
+	seen := make(map[uint]bool)
+	var keys []string
+	for _, m := range messages {
+		if !seen[m.RoomID] {
+			seen[m.RoomID] = true
+			keys = append(keys, fmt.Sprintf(lastMessageKeyFmt, m.RoomID))
+		}
+	}
+	r.rdb.Del(context.Background(), keys...)
+	for roomID := range seen {
+		touchRoom(r.db, r.rdb, roomID)
+	}
+}
+
+// readUpTo updates userID's counter after a read: reading the latest
+// message clears it, a partial read drops it for a rebuild.
+func (r *messageRepo) readUpTo(roomID uint, userID uint, lastReadMessageID uint) {
+	ctx := context.Background()
+	key := fmt.Sprintf(unreadKeyFmt, userID)
+	field := strconv.FormatUint(uint64(roomID), 10)
+	defer touchLists(r.rdb, roomID, userID)
+
+	var snap chat.LastMessage
+	val, err := r.rdb.Get(ctx, fmt.Sprintf(lastMessageKeyFmt, roomID)).Result()
+	readLatest := err == nil && json.Unmarshal([]byte(val), &snap) == nil && snap.ID <= lastReadMessageID
+
+	if r.isBroadcast(roomID) {
+		r.rdb.HDel(ctx, key, field)
+		field = fmt.Sprintf(readSeqFieldFmt, roomID)
+		if readLatest {
+			if seq, err := r.rdb.Get(ctx, fmt.Sprintf(roomSeqKeyFmt, roomID)).Int64(); err == nil {
+				r.rdb.HSet(ctx, key, field, seq)
+				return
+			}
+		}
+		r.rdb.HDel(ctx, key, field)
+		return
+	}
+	if readLatest {
+		r.rdb.HSet(ctx, key, field, 0)
+		return
+	}
+	r.rdb.HDel(ctx, key, field)
+}
+
+func (r *messageRepo) isBroadcast(roomID uint) bool {
+	var types []room.RoomType
+	r.db.Unscoped().Model(&room.Room{}).Where("id = ?", roomID).Pluck("type", &types)
+	return len(types) == 1 && types[0] == room.RoomTypeBroadcast
+}
+
+func (r *messageRepo) Summaries(userID uint, roomIDs []uint, largeRoomIDs []uint) (map[uint]*chat.RoomSummary, error) {
+	summaries := make(map[uint]*chat.RoomSummary, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return summaries, nil
+	}
+	for _, id := range roomIDs {
+		summaries[id] = &chat.RoomSummary{}
+	}
+
+	// Read receipts of every member, which also give the user's positions.
+	// Large rooms only show the user their own.
+	db := r.db.Where("room_id IN ?", roomIDs)
+	if len(largeRoomIDs) > 0 {
+		db = db.Where("user_id = ? OR room_id NOT IN ?", userID, largeRoomIDs)
+	}
+	var receipts []chat.ReadReceipt
+	if err := db.Find(&receipts).Error; err != nil {
+		return nil, err
+	}
+	for _, rc := range receipts {
+		s := summaries[rc.RoomID]
+		s.ReadStatus = append(s.ReadStatus, rc)
+	}
+
+	if err := r.loadUnread(userID, roomIDs, summaries); err != nil {
+		return nil, err
+	}
+	if err := r.loadLastMessages(roomIDs, summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (r *messageRepo) loadUnread(userID uint, roomIDs []uint, summaries map[uint]*chat.RoomSummary) error {
+	ctx := context.Background()
+	key := fmt.Sprintf(unreadKeyFmt, userID)
+
+	// Each room's counter, then its read position and seq in case it is a
+	// broadcast channel
+	n := len(roomIDs)
+	fields := make([]string, 2*n)
+	seqKeys := make([]string, n)
+	for i, id := range roomIDs {
+		fields[i] = strconv.FormatUint(uint64(id), 10)
+		fields[n+i] = fmt.Sprintf(readSeqFieldFmt, id)
+		seqKeys[i] = fmt.Sprintf(roomSeqKeyFmt, id)
+	}
+	vals, err := r.rdb.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		vals = make([]interface{}, 2*n)
+	}
+	seqs, err := r.rdb.MGet(ctx, seqKeys...).Result()
+	if err != nil {
+		seqs = make([]interface{}, n)
+	}
+
+	var missing []uint
+	for i, id := range roomIDs {
+		if seq, ok := seqs[i].(string); ok {
+			read, ok := vals[n+i].(string)
+			if !ok {
+				missing = append(missing, id)
+				continue
+			}
+			s, _ := strconv.ParseInt(seq, 10, 64)
+			rd, _ := strconv.ParseInt(read, 10, 64)
+			if s > rd {
+				summaries[id].UnreadCount = s - rd
+			}
+			continue
+		}
+		s, ok := vals[i].(string)
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		count, _ := strconv.ParseInt(s, 10, 64)
+		summaries[id].UnreadCount = count
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// Open the pending lists before counting, see the top of the file
+	pipe := r.rdb.Pipeline()
+	for _, id := range missing {
+		pipe.HSetNX(ctx, key, fmt.Sprintf(pendingFieldFmt, id), "")
+	}
+	pipe.Expire(ctx, key, unreadTTL)
+	pipe.Exec(ctx)
+
+	var rows []struct {
+		RoomID uint
+		Count  int64
+	}
+	var latest map[uint]uint
+	// One transaction, so that the counts and the latest ids come from the
+	// same snapshot
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("messages AS m").
+			Select("m.room_id, COUNT(*) AS count").
+			Joins("LEFT JOIN read_receipts AS rr ON rr.room_id = m.room_id AND rr.user_id = ?", userID).
+			Where("m.room_id IN ? AND m.sender_id <> ? AND m.deleted_at IS NULL", missing, userID).
+			Where("m.id > COALESCE(rr.last_read_message_id, 0)").
+			Group("m.room_id").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		var err error
+		latest, err = latestMessageIDs(tx, missing)
+		return err
+	}); err != nil {
+		return err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+
+	rebuilt, err := r.broadcastSeqs(missing)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		summaries[id].UnreadCount = counts[id]
+		if seq, ok := rebuilt[id]; ok {
+			r.rdb.HDel(ctx, key, fmt.Sprintf(pendingFieldFmt, id))
+			r.rdb.HSet(ctx, key, fmt.Sprintf(readSeqFieldFmt, id), seq-counts[id])
+			continue
+		}
+		field := strconv.FormatUint(uint64(id), 10)
+		count, err := setUnreadScript.Run(ctx, r.rdb, []string{key}, field, fmt.Sprintf(pendingFieldFmt, id), counts[id], latest[id]).Int64()
+		if err != nil {
+			logger.L.Warn("failed to cache unread counter", zap.Error(err), zap.Uint("user_id", userID), zap.Uint("room_id", id))
+			continue
+		}
+		summaries[id].UnreadCount = count
+	}
+	return nil
+}
+
+// latestMessageIDs returns the highest message id of each room, deleted
+// messages included.
+func latestMessageIDs(db *gorm.DB, roomIDs []uint) (map[uint]uint, error) {
+	var rows []struct {
+		RoomID uint
+		MaxID  uint
+	}
+	if err := db.Model(&chat.Message{}).Unscoped().
+		Select("room_id, MAX(id) AS max_id").
+		Where("room_id IN ?", roomIDs).
+		Group("room_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	latest := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		latest[row.RoomID] = row.MaxID
+	}
+	return latest, nil
+}
+
+// broadcastSeqs returns the seq of the broadcast channels among roomIDs,
+// rebuilding those that are not cached.
+func (r *messageRepo) broadcastSeqs(roomIDs []uint) (map[uint]int64, error) {
+	ctx := context.Background()
+	var ids []uint
+	if err := r.db.Model(&room.Room{}).
+		Where("id IN ? AND type = ?", roomIDs, room.RoomTypeBroadcast).
+		Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	// Open the pending lists before counting, see the top of the file
+	pipe := r.rdb.Pipeline()
+	for _, id := range ids {
+		pipe.SetNX(ctx, fmt.Sprintf(pendingSeqKeyFmt, id), "", unreadTTL)
+	}
+	pipe.Exec(ctx)
+
+	var rows []struct {
+		RoomID uint
+		Count  int64
+	}
+	var latest map[uint]uint
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&chat.Message{}).
+			Select("room_id, COUNT(*) AS count").
+			Where("room_id IN ?", ids).
+			Group("room_id").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		var err error
+		latest, err = latestMessageIDs(tx, ids)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+
+	seqs := make(map[uint]int64, len(ids))
+	for _, id := range ids {
+		keys := []string{fmt.Sprintf(roomSeqKeyFmt, id), fmt.Sprintf(pendingSeqKeyFmt, id)}
+		seq, err := setRoomSeqScript.Run(ctx, r.rdb, keys, counts[id], latest[id], int(unreadTTL.Seconds())).Int64()
+		if err != nil {
+			seq = counts[id]
+		}
+		seqs[id] = seq
+	}
+	return seqs, nil
+}
+
+func (r *messageRepo) loadLastMessages(roomIDs []uint, summaries map[uint]*chat.RoomSummary) error {
+	ctx := context.Background()
+
+	keys := make([]string, len(roomIDs))
+	for i, id := range roomIDs {
+		keys[i] = fmt.Sprintf(lastMessageKeyFmt, id)
+	}
+	vals, err := r.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		vals = make([]interface{}, len(roomIDs))
+	}
+
+	var missing []uint
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			missing = append(missing, roomIDs[i])
+			continue
+		}
+		var snap *chat.LastMessage
+		if err := json.Unmarshal([]byte(s), &snap); err != nil {
+			missing = append(missing, roomIDs[i])
+			continue
+		}
+		summaries[roomIDs[i]].LastMessage = snap
+	}
+
+	if len(missing) > 0 {
+		latest := r.db.Model(&chat.Message{}).Select("MAX(id)").Where("room_id IN ?", missing).Group("room_id")
+		var messages []chat.Message
+		if err := r.db.Where("id IN (?)", latest).Find(&messages).Error; err != nil {
+			return err
+		}
+		pipe := r.rdb.Pipeline()
+		found := make(map[uint]bool, len(messages))
+		for i := range messages {
+			snap := messages[i].Snapshot()
+			summaries[messages[i].RoomID].LastMessage = snap
+			found[messages[i].RoomID] = true
+			data, _ := json.Marshal(snap)
+			pipe.Set(ctx, fmt.Sprintf(lastMessageKeyFmt, messages[i].RoomID), data, lastMessageTTL)
+		}
+		for _, id := range missing {
+			if !found[id] {
+				pipe.Set(ctx, fmt.Sprintf(lastMessageKeyFmt, id), "null", lastMessageTTL)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.L.Warn("failed to cache last messages", zap.Error(err))
+		}
+	}
+
+	// Sender names are looked up fresh, they may have changed
+	var senderIDs []uint
+	for _, s := range summaries {
+		if s.LastMessage != nil {
+			senderIDs = append(senderIDs, s.LastMessage.SenderID)
+		}
+	}
+	if len(senderIDs) == 0 {
+		return nil
+	}
+	var senders []user.User
+	if err := r.db.Select("id", "username", "nickname").Where("id IN ?", senderIDs).Find(&senders).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*user.User, len(senders))
+	for i := range senders {
+		byID[senders[i].ID] = &senders[i]
+	}
+	for _, s := range summaries {
+		if s.LastMessage == nil {
+			continue
+		}
+		if u, ok := byID[s.LastMessage.SenderID]; ok {
+			s.LastMessage.Sender.Username = u.Username
+			s.LastMessage.Sender.Nickname = u.Nickname
+		}
+	}
+	return nil
+}
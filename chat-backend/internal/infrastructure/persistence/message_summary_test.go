@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestUnreadRebuildCountsRacingSends(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	user := testUserIDs(t, rdb, 1)[0]
+	key := fmt.Sprintf(unreadKeyFmt, user)
+	t.Cleanup(func() { rdb.Del(ctx, key) })
+	const roomID = 7
+	field, pending := "7", fmt.Sprintf(pendingFieldFmt, roomID)
+
+	// Without a counter or a rebuild in progress, sends leave no trace
+	if err := incrUnreadScript.Run(ctx, rdb, []string{key}, field, pending, 5).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := rdb.HLen(ctx, key).Val(); n != 0 {
+		t.Fatalf("hash holds %d fields, want none", n)
+	}
+
+	// The rebuild counts 3 unread messages up to message 10; message 9 was
+	// sent before the count saw it, 11 and 12 after
+	rdb.HSetNX(ctx, key, pending, "")
+	for _, id := range []uint{9, 11, 12} {
+		incrUnreadScript.Run(ctx, rdb, []string{key}, field, pending, id)
+	}
+	count, err := setUnreadScript.Run(ctx, rdb, []string{key}, field, pending, 3, 10).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("rebuilt count = %d, want 5", count)
+	}
+	if rdb.HExists(ctx, key, pending).Val() {
+		t.Error("pending list left behind")
+	}
+
+	// Later sends increment the counter; a second rebuild keeps it
+	incrUnreadScript.Run(ctx, rdb, []string{key}, field, pending, 13)
+	rdb.HSetNX(ctx, key, pending, "")
+	if count, _ := setUnreadScript.Run(ctx, rdb, []string{key}, field, pending, 0, 13).Int64(); count != 6 {
+		t.Errorf("count after a concurrent rebuild = %d, want 6", count)
+	}
+	if got := rdb.HGet(ctx, key, field).Val(); got != "6" {
+		t.Errorf("stored count = %s, want 6", got)
+	}
+}
+
+func TestRoomSeqRebuildCountsRacingSends(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	sender := testUserIDs(t, rdb, 1)[0]
+	roomID := sender // unique per run
+	keys := []string{fmt.Sprintf(roomSeqKeyFmt, roomID), fmt.Sprintf(unreadKeyFmt, sender), fmt.Sprintf(pendingSeqKeyFmt, roomID)}
+	t.Cleanup(func() { rdb.Del(ctx, keys...) })
+	readField := fmt.Sprintf(readSeqFieldFmt, roomID)
+
+	rdb.SetNX(ctx, keys[2], "", unreadTTL)
+	for _, id := range []uint{20, 21} {
+		incrRoomSeqScript.Run(ctx, rdb, keys, readField, id)
+	}
+	seq, err := setRoomSeqScript.Run(ctx, rdb, []string{keys[0], keys[2]}, 20, 20, 60).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 21 {
+		t.Fatalf("rebuilt seq = %d, want 21", seq)
+	}
+	incrRoomSeqScript.Run(ctx, rdb, keys, readField, 22)
+	if got, _ := rdb.Get(ctx, keys[0]).Int64(); got != 22 {
+		t.Errorf("seq after a send = %d, want 22", got)
+	}
+}
@@ -0,0 +1,19 @@
+package persistence
+
+import (
+	"chat-backend/internal/domain/moderation"
+
+	"gorm.io/gorm"
+)
+
+type moderationRepo struct {
+	db *gorm.DB
+}
+
+func NewModerationRepository(db *gorm.DB) moderation.Repository {
+	return &moderationRepo{db: db}
+}
+
+func (r *moderationRepo) Create(review *moderation.Review) error {
+	return r.db.Create(review).Error
+}
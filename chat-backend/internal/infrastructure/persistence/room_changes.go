@@ -0,0 +1,113 @@
+package persistence
+
+import (
+	"chat-backend/pkg/logger"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Conversation list versions. Every change that shows up in a user's room
+// list takes the next value of a global counter and records it against the
+// room in the user's change log:
+//
+//   - roomlist:version  global counter
+//   - roomlist:<user>   sorted set of room id -> version of its last change,
+//     plus a "floor" member: changes after the floor are complete
+//
+// A log that expired is recreated with a new floor, so clients syncing from
+// before it get a full list instead of a partial one.
+const (
+	listVersionKey   = "roomlist:version"
+	listChangesFmt   = "roomlist:%d"
+	listChangesFloor = "floor"
+	listChangesTTL   = 30 * 24 * time.Hour
+)
+
+// KEYS[1] is the counter, the rest are change logs; ARGV[1] is the room
+// id and ARGV[2] the log TTL in seconds
+var touchListsScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 0 then
+		redis.call('ZADD', KEYS[i], v - 1, 'floor')
+	end
+	redis.call('ZADD', KEYS[i], v, ARGV[1])
+	redis.call('EXPIRE', KEYS[i], ARGV[2])
+end
+return v
+`)
+
+// Most change logs one script call touches, so that broadcast channels do
+// not hold Redis for one script per tens of thousands of subscribers
+const touchListsBatch = 1000
+
+// touchLists records a change to roomID in the lists of userIDs
+func touchLists(rdb *redis.Client, roomID uint, userIDs ...uint) {
+	for len(userIDs) > touchListsBatch {
+		touchLists(rdb, roomID, userIDs[:touchListsBatch]...)
+		userIDs = userIDs[touchListsBatch:]
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(userIDs)+1)
+	keys = append(keys, listVersionKey)
+	for _, id := range userIDs {
+		keys = append(keys, fmt.Sprintf(listChangesFmt, id))
+	}
+	if err := touchListsScript.Run(context.Background(), rdb, keys, roomID, int(listChangesTTL.Seconds())).Err(); err != nil {
+		// Without the entry a sync would miss the change; force a full one
+		logger.L.Warn("failed to record conversation list change", zap.Error(err), zap.Uint("room_id", roomID))
+		rdb.Del(context.Background(), keys[1:]...)
+	}
+}
+
+// touchRoom records a change to roomID in the lists of all its members
+func touchRoom(db *gorm.DB, rdb *redis.Client, roomID uint, extra ...uint) {
+	var memberIDs []uint
+	if err := db.Table("room_members").Where("room_id = ?", roomID).Pluck("user_id", &memberIDs).Error; err != nil {
+		logger.L.Warn("failed to load members for conversation list change", zap.Error(err), zap.Uint("room_id", roomID))
+	}
+	touchLists(rdb, roomID, append(memberIDs, extra...)...)
+}
+
+func (r *roomRepo) Changes(userID uint, since uint64) (uint64, []uint, bool, error) {
+	ctx := context.Background()
+
+	// Read the version first: later changes may be listed twice, never lost
+	version, err := r.rdb.Get(ctx, listVersionKey).Uint64()
+	if err != nil && err != redis.Nil {
+		return 0, nil, false, err
+	}
+	key := fmt.Sprintf(listChangesFmt, userID)
+	if since == 0 || since > version {
+		return version, nil, false, nil
+	}
+	floor, err := r.rdb.ZScore(ctx, key, listChangesFloor).Result()
+	if err == redis.Nil || (err == nil && since < uint64(floor)) {
+		return version, nil, false, nil
+	} else if err != nil {
+		return 0, nil, false, err
+	}
+
+	members, err := r.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(since, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return 0, nil, false, err
+	}
+	roomIDs := make([]uint, 0, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseUint(m, 10, 32); err == nil {
+			roomIDs = append(roomIDs, uint(id))
+		}
+	}
+	return version, roomIDs, true, nil
+}
@@ -0,0 +1,154 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis connects to REDIS_ADDR (default localhost:6379) and skips the
+// test when no server answers.
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DialTimeout: 200 * time.Millisecond, MaxRetries: -1})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis unavailable at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// testUserIDs returns n user ids unlikely to collide with other runs and
+// drops their change logs when the test ends.
+func testUserIDs(t *testing.T, rdb *redis.Client, n int) []uint {
+	base := uint(time.Now().UnixNano()%1_000_000)*1000 + 1_000_000_000
+	ids := make([]uint, n)
+	keys := make([]string, n)
+	for i := range ids {
+		ids[i] = base + uint(i)
+		keys[i] = fmt.Sprintf(listChangesFmt, ids[i])
+	}
+	t.Cleanup(func() { rdb.Del(context.Background(), keys...) })
+	return ids
+}
+
+func TestChangesSinceVersion(t *testing.T) {
+	rdb := newTestRedis(t)
+	repo := &roomRepo{rdb: rdb}
+	users := testUserIDs(t, rdb, 2)
+	alice, bob := users[0], users[1]
+
+	version, _, complete, err := repo.Changes(alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete {
+		t.Fatal("since 0 must ask for a full list")
+	}
+	if _, _, complete, _ := repo.Changes(alice, version); complete {
+		t.Fatal("a user without a change log must get a full list")
+	}
+
+	touchLists(rdb, 1, alice, bob)
+	v1, rooms, complete, err := repo.Changes(alice, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !complete || !equalIDs(rooms, 1) {
+		t.Fatalf("Changes(since=%d) = %v complete=%v, want [1] complete", version, rooms, complete)
+	}
+	if v1 <= version {
+		t.Fatalf("version did not advance: %d -> %d", version, v1)
+	}
+
+	if _, rooms, complete, _ := repo.Changes(alice, v1); !complete || len(rooms) != 0 {
+		t.Fatalf("Changes(since=current) = %v complete=%v, want nothing", rooms, complete)
+	}
+
+	touchLists(rdb, 2, alice)
+	touchLists(rdb, 1, alice)
+	_, rooms, complete, _ = repo.Changes(alice, v1)
+	if !complete || !equalIDs(rooms, 2, 1) {
+		t.Fatalf("Changes(since=%d) = %v complete=%v, want [2 1] in change order", v1, rooms, complete)
+	}
+
+	// Changes to alice's list do not show up in bob's
+	_, rooms, complete, _ = repo.Changes(bob, v1)
+	if !complete || len(rooms) != 0 {
+		t.Fatalf("bob's changes = %v complete=%v, want nothing", rooms, complete)
+	}
+}
+
+func TestChangesBeforeFloorIsFull(t *testing.T) {
+	rdb := newTestRedis(t)
+	repo := &roomRepo{rdb: rdb}
+	user := testUserIDs(t, rdb, 1)[0]
+
+	before, _, _, err := repo.Changes(user, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another user's change moves the counter past what this log covers
+	other := testUserIDs(t, rdb, 1)[0] + 500
+	t.Cleanup(func() { rdb.Del(context.Background(), fmt.Sprintf(listChangesFmt, other)) })
+	touchLists(rdb, 7, other)
+
+	touchLists(rdb, 1, user)
+	if _, _, complete, _ := repo.Changes(user, before); complete {
+		t.Fatal("a cursor from before the log's floor must get a full list")
+	}
+
+	version, _, _, _ := repo.Changes(user, 0)
+	if _, _, complete, _ := repo.Changes(user, version+10); complete {
+		t.Fatal("a cursor from the future must get a full list")
+	}
+
+	// An expired log is recreated with a new floor: a cursor that had not
+	// seen room 1's change cannot be served from it
+	rdb.Del(context.Background(), fmt.Sprintf(listChangesFmt, user))
+	touchLists(rdb, 3, user)
+	if _, _, complete, _ := repo.Changes(user, version-1); complete {
+		t.Fatal("a cursor from before an expired log must get a full list")
+	}
+}
+
+func TestTouchListsLargeRoom(t *testing.T) {
+	rdb := newTestRedis(t)
+	repo := &roomRepo{rdb: rdb}
+	users := testUserIDs(t, rdb, touchListsBatch+10)
+	touchLists(rdb, 1, users...) // start every log
+
+	version, _, _, err := repo.Changes(users[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	touchLists(rdb, 9, users...)
+	for _, user := range []uint{users[0], users[touchListsBatch-1], users[touchListsBatch], users[len(users)-1]} {
+		if _, rooms, complete, _ := repo.Changes(user, version); !complete || !equalIDs(rooms, 9) {
+			t.Fatalf("user %d changes = %v complete=%v, want [9]", user, rooms, complete)
+		}
+	}
+}
+
+func equalIDs(got []uint, want ...uint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
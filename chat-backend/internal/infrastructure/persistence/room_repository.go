@@ -6,23 +6,34 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// privilegedRoles are the memberships loaded with every room; everyone
+// else's are loaded on demand so that large rooms stay cheap to cache.
+var privilegedRoles = []room.Role{room.RoleOwner, room.RoleAdmin}
+
 type roomRepo struct {
-	db  *gorm.DB
-	rdb *redis.Client
+	db     *gorm.DB
+	rdb    *redis.Client
+	limits room.Limits
 }
 
-func NewRoomRepository(db *gorm.DB, rdb *redis.Client) room.Repository {
-	return &roomRepo{db: db, rdb: rdb}
+func NewRoomRepository(db *gorm.DB, rdb *redis.Client, limits room.Limits) room.Repository {
+	return &roomRepo{db: db, rdb: rdb, limits: limits}
 }
 
 func (r *roomRepo) Create(rm *room.Room) error {
-	return r.db.Create(rm).Error
+	err := r.db.Create(rm).Error
+	if err == nil {
+		touchRoom(r.db, r.rdb, rm.ID)
+	}
+	return err
 }
 
 func (r *roomRepo) GetByID(id uint) (*room.Room, error) {
@@ -39,10 +50,13 @@ func (r *roomRepo) GetByID(id uint) (*room.Room, error) {
 	}
 
 	var rm room.Room
-	err = r.db.Preload("Members").First(&rm, id).Error
+	err = r.db.Preload("Memberships", "role IN ?", privilegedRoles).Preload("Announcement.Author").First(&rm, id).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := r.fillMembers([]*room.Room{&rm}); err != nil {
+		return nil, err
+	}
 
 	// Set cache
 	data, _ := json.Marshal(rm)
@@ -51,15 +65,35 @@ func (r *roomRepo) GetByID(id uint) (*room.Room, error) {
 	return &rm, nil
 }
 
-func (r *roomRepo) GetByUserID(userID uint) ([]room.Room, error) {
+func (r *roomRepo) GetByUserID(userID uint, archived bool) ([]room.Room, error) {
+	var rooms []room.Room
+	err := r.db.Model(&room.Room{}).
+		Joins("JOIN room_members ON room_members.room_id = rooms.id").
+		Where("room_members.user_id = ? AND room_members.is_hidden = ? AND room_members.archived = ?", userID, false, archived).
+		Preload("Memberships", "role IN ? OR user_id = ?", privilegedRoles, userID).Preload("Announcement.Author").
+		Order("room_members.pin_order = 0, room_members.pin_order, rooms.updated_at DESC").
+		Find(&rooms).Error
+	if err != nil {
+		return nil, err
+	}
+	return rooms, r.fillRoomMembers(rooms)
+}
+
+func (r *roomRepo) GetForUser(userID uint, roomIDs []uint) ([]room.Room, error) {
 	var rooms []room.Room
+	if len(roomIDs) == 0 {
+		return rooms, nil
+	}
 	err := r.db.Model(&room.Room{}).
 		Joins("JOIN room_members ON room_members.room_id = rooms.id").
-		Where("room_members.user_id = ? AND room_members.is_hidden = ?", userID, false).
-		Preload("Members").
-		Order("updated_at DESC").
+		Where("room_members.user_id = ? AND rooms.id IN ?", userID, roomIDs).
+		Preload("Memberships", "role IN ? OR user_id = ?", privilegedRoles, userID).Preload("Announcement.Author").
+		Order("room_members.pin_order = 0, room_members.pin_order, rooms.updated_at DESC").
 		Find(&rooms).Error
-	return rooms, err
+	if err != nil {
+		return nil, err
+	}
+	return rooms, r.fillRoomMembers(rooms)
 }
 
 func (r *roomRepo) GetPrivateRoomBetweenUsers(userID1, userID2 uint) (*room.Room, error) {
@@ -70,26 +104,46 @@ func (r *roomRepo) GetPrivateRoomBetweenUsers(userID1, userID2 uint) (*room.Room
 		Where("rooms.type = ?", room.RoomTypePrivate).
 		Where("rm1.user_id = ?", userID1).
 		Where("rm2.user_id = ?", userID2).
-		Preload("Members").
+		Preload("Memberships").Preload("Announcement.Author").
 		First(&rm).Error
 	if err != nil {
 		return nil, err
 	}
-	return &rm, nil
+	return &rm, r.fillMembers([]*room.Room{&rm})
 }
 
 func (r *roomRepo) Update(rm *room.Room) error {
-	return r.db.Save(rm).Error
+	// Members are managed through AddMember/RemoveMember only
+	err := r.db.Omit(clause.Associations).Save(rm).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", rm.ID))
+		touchRoom(r.db, r.rdb, rm.ID)
+	}
+	return err
 }
 
 func (r *roomRepo) Delete(id uint) error {
-	return r.db.Delete(&room.Room{}, id).Error
+	err := r.db.Delete(&room.Room{}, id).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", id), fmt.Sprintf("room:%d:members", id), fmt.Sprintf("room:%d:muted", id))
+		touchRoom(r.db, r.rdb, id)
+		r.membershipChanged(id, 0, false)
+	}
+	return err
 }
 
 func (r *roomRepo) AddMember(roomID uint, userID uint) error {
-	err := r.db.Model(&room.Room{ID: roomID}).Association("Members").Append(&user.User{ID: userID})
+	// Existing members keep their role and join time
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&room.RoomMember{
+		RoomID:   roomID,
+		UserID:   userID,
+		Role:     room.RoleMember,
+		JoinedAt: time.Now(),
+	}).Error
 	if err == nil {
-		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID), fmt.Sprintf("room:%d:members", roomID))
+		touchRoom(r.db, r.rdb, roomID)
+		r.membershipChanged(roomID, userID, true)
 	}
 	return err
 }
@@ -97,13 +151,408 @@ func (r *roomRepo) AddMember(roomID uint, userID uint) error {
 func (r *roomRepo) RemoveMember(roomID uint, userID uint) error {
 	err := r.db.Model(&room.Room{ID: roomID}).Association("Members").Delete(&user.User{ID: userID})
 	if err == nil {
-		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID), fmt.Sprintf("room:%d:members", roomID), fmt.Sprintf("room:%d:muted", roomID))
+		touchRoom(r.db, r.rdb, roomID, userID)
+		r.membershipChanged(roomID, userID, false)
 	}
 	return err
 }
 
+// IsMember checks membership against a Redis set of member IDs, loaded from
+// the database on a miss. The set always holds the sentinel 0 so that rooms
+// without members are cached too.
+func (r *roomRepo) IsMember(roomID uint, userID uint) (bool, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("room:%d:members", roomID)
+
+	// Try cache
+	res, err := r.rdb.SMIsMember(ctx, cacheKey, 0, userID).Result()
+	if err == nil && res[0] {
+		return res[1], nil
+	}
+
+	userIDs, err := loadMemberSet(r.db, r.rdb, roomID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range userIDs {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *roomRepo) MemberIDs(roomID uint) ([]uint, error) {
+	return memberIDs(r.db, r.rdb, roomID)
+}
+
+// memberIDs lists the room's members from the room:<id>:members set,
+// loading it on a miss.
+func memberIDs(db *gorm.DB, rdb *redis.Client, roomID uint) ([]uint, error) {
+	ctx := context.Background()
+	members, err := rdb.SMembers(ctx, fmt.Sprintf("room:%d:members", roomID)).Result()
+	if err == nil && len(members) > 0 {
+		ids := make([]uint, 0, len(members)-1)
+		for _, m := range members {
+			if id, err := strconv.ParseUint(m, 10, 32); err == nil && id != 0 {
+				ids = append(ids, uint(id))
+			}
+		}
+		return ids, nil
+	}
+	return loadMemberSet(db, rdb, roomID)
+}
+
+// loadMemberSet reads the room's members from the database into the
+// room:<id>:members set.
+func loadMemberSet(db *gorm.DB, rdb *redis.Client, roomID uint) ([]uint, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("room:%d:members", roomID)
+
+	var userIDs []uint
+	err := db.Table("room_members").
+		Joins("JOIN rooms ON rooms.id = room_members.room_id AND rooms.deleted_at IS NULL").
+		Where("room_members.room_id = ?", roomID).
+		Pluck("room_members.user_id", &userIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Set cache
+	members := make([]interface{}, 0, len(userIDs)+1)
+	members = append(members, 0)
+	for _, id := range userIDs {
+		members = append(members, id)
+	}
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, cacheKey)
+	pipe.SAdd(ctx, cacheKey, members...)
+	pipe.Expire(ctx, cacheKey, 10*time.Minute)
+	pipe.Exec(ctx)
+
+	return userIDs, nil
+}
+
+func (r *roomRepo) LoadMemberships(rm *room.Room, userIDs ...uint) error {
+	loaded := make(map[uint]bool, len(rm.Memberships))
+	for _, m := range rm.Memberships {
+		loaded[m.UserID] = true
+	}
+	var missing []uint
+	for _, id := range userIDs {
+		if !loaded[id] {
+			loaded[id] = true
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	var rows []room.RoomMember
+	if err := r.db.Where("room_id = ? AND user_id IN ?", rm.ID, missing).Find(&rows).Error; err != nil {
+		return err
+	}
+	rm.Memberships = append(rm.Memberships, rows...)
+	return nil
+}
+
+// NotifyMutedMembers is cached as room:<id>:muted, which only holds the
+// few members who muted the room.
+func (r *roomRepo) NotifyMutedMembers(roomID uint) ([]room.RoomMember, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("room:%d:muted", roomID)
+
+	var rows []room.RoomMember
+	if val, err := r.rdb.Get(ctx, cacheKey).Result(); err == nil {
+		if err := json.Unmarshal([]byte(val), &rows); err == nil {
+			return rows, nil
+		}
+	}
+	err := r.db.Where("room_id = ? AND notify_muted = ?", roomID, true).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(rows)
+	r.rdb.Set(ctx, cacheKey, data, 10*time.Minute)
+	return rows, nil
+}
+
+func (r *roomRepo) Successor(roomID uint, ownerID uint) (uint, bool, error) {
+	var ids []uint
+	// Rows from before joined_at was recorded sort first
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id <> ? AND role <> ?", roomID, ownerID, room.RoleOwner).
+		Order(clause.Expr{SQL: "role = ? DESC, joined_at IS NOT NULL, joined_at, user_id", Vars: []interface{}{room.RoleAdmin}}).
+		Limit(1).
+		Pluck("user_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, false, err
+	}
+	return ids[0], true, nil
+}
+
+// MemberCount counts from the cached member set when present, which also
+// holds the sentinel 0.
+func (r *roomRepo) MemberCount(roomID uint) (int64, error) {
+	ctx := context.Background()
+	n, err := r.rdb.SCard(ctx, fmt.Sprintf("room:%d:members", roomID)).Result()
+	if err == nil && n > 0 {
+		return n - 1, nil
+	}
+	var count int64
+	err = r.db.Table("room_members").Where("room_id = ?", roomID).Count(&count).Error
+	return count, err
+}
+
 func (r *roomRepo) SetHidden(roomID uint, userID uint, hidden bool) error {
-	return r.db.Model(&room.RoomMember{}).
+	err := r.db.Model(&room.RoomMember{}).
 		Where("room_id = ? AND user_id = ?", roomID, userID).
 		Update("is_hidden", hidden).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchLists(r.rdb, roomID, userID)
+	}
+	return err
+}
+
+func (r *roomRepo) UnhideForAll(roomID uint) ([]uint, error) {
+	var userIDs []uint
+	if err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND is_hidden = ?", roomID, true).
+		Pluck("user_id", &userIDs).Error; err != nil || len(userIDs) == 0 {
+		return nil, err
+	}
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id IN ? AND is_hidden = ?", roomID, userIDs, true).
+		Update("is_hidden", false).Error
+	if err != nil {
+		return nil, err
+	}
+	r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+	touchLists(r.rdb, roomID, userIDs...)
+	return userIDs, nil
+}
+
+func (r *roomRepo) SetRole(roomID uint, userID uint, role room.Role) error {
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchRoom(r.db, r.rdb, roomID)
+	}
+	return err
+}
+
+func (r *roomRepo) TransferOwnership(roomID uint, from uint, to uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&room.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, from).
+			Update("role", room.RoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&room.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, to).
+			Update("role", room.RoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&room.Room{ID: roomID}).Update("creator_id", to).Error
+	})
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchRoom(r.db, r.rdb, roomID)
+	}
+	return err
+}
+
+func (r *roomRepo) SetMutedUntil(roomID uint, userID uint, until *time.Time) error {
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("muted_until", until).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchRoom(r.db, r.rdb, roomID)
+	}
+	return err
+}
+
+func (r *roomRepo) SetAnnouncement(a *room.Announcement) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"author_id", "content", "format", "plain_text", "updated_at"}),
+	}).Omit("Author").Create(a).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", a.RoomID))
+		touchRoom(r.db, r.rdb, a.RoomID)
+	}
+	return err
+}
+
+func (r *roomRepo) DeleteAnnouncement(roomID uint) error {
+	err := r.db.Where("room_id = ?", roomID).Delete(&room.Announcement{}).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchRoom(r.db, r.rdb, roomID)
+	}
+	return err
+}
+
+func (r *roomRepo) AcknowledgeAnnouncement(roomID uint, userID uint, at time.Time) error {
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("announcement_ack_at", at).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID))
+		touchLists(r.rdb, roomID, userID)
+	}
+	return err
+}
+
+func (r *roomRepo) UpdateSettings(roomID uint, userID uint, settings room.MemberSettings) error {
+	err := r.db.Model(&room.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Select("notify_muted", "notify_muted_until", "pin_order", "alias", "archived").
+		Updates(room.RoomMember{Settings: settings}).Error
+	if err == nil {
+		r.rdb.Del(context.Background(), fmt.Sprintf("room:%d", roomID), fmt.Sprintf("room:%d:muted", roomID))
+		touchLists(r.rdb, roomID, userID)
+	}
+	return err
+}
+
+func (r *roomRepo) SearchChannels(query string, limit int, offset int) ([]room.ChannelInfo, error) {
+	var channels []room.ChannelInfo
+	db := r.db.Model(&room.Room{}).
+		Select("rooms.id, rooms.type, rooms.name, rooms.avatar, rooms.description, rooms.join_approval, rooms.created_at, COUNT(room_members.user_id) AS member_count").
+		Joins("LEFT JOIN room_members ON room_members.room_id = rooms.id").
+		Where("rooms.type IN ?", []room.RoomType{room.RoomTypeChannel, room.RoomTypeBroadcast})
+	if query != "" {
+		like := "%" + escapeLike(query) + "%"
+		db = db.Where("rooms.name LIKE ? OR rooms.description LIKE ?", like, like)
+	}
+	err := db.Group("rooms.id").
+		Order("member_count DESC, rooms.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&channels).Error
+	return channels, err
+}
+
+func (r *roomRepo) TypeOf(roomID uint) (room.RoomType, error) {
+	var t room.RoomType
+	err := r.db.Unscoped().Model(&room.Room{}).Where("id = ?", roomID).Pluck("type", &t).Error
+	return t, err
+}
+
+func (r *roomRepo) RoomIDsByType(userID uint, t room.RoomType) ([]uint, error) {
+	var ids []uint
+	err := r.db.Table("room_members").
+		Joins("JOIN rooms ON rooms.id = room_members.room_id AND rooms.deleted_at IS NULL").
+		Where("room_members.user_id = ? AND rooms.type = ?", userID, t).
+		Pluck("room_members.room_id", &ids).Error
+	return ids, err
+}
+
+// membershipChanged tells every instance's hub about a join or leave
+func (r *roomRepo) membershipChanged(roomID uint, userID uint, joined bool) {
+	data, _ := json.Marshal(room.MembershipChange{RoomID: roomID, UserID: userID, Joined: joined})
+	r.rdb.Publish(context.Background(), fmt.Sprintf("%s%d", room.MembershipChannelPrefix, roomID), data)
+}
+
+func (r *roomRepo) fillRoomMembers(rooms []room.Room) error {
+	ptrs := make([]*room.Room, len(rooms))
+	for i := range rooms {
+		ptrs[i] = &rooms[i]
+	}
+	return r.fillMembers(ptrs)
+}
+
+// fillMembers sets MemberCount and Large, then loads Members, in one query,
+// for the rooms that are not large.
+func (r *roomRepo) fillMembers(rooms []*room.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(rooms))
+	for i, rm := range rooms {
+		ids[i] = rm.ID
+	}
+	var counts []struct {
+		RoomID uint
+		Count  int64
+	}
+	if err := r.db.Table("room_members").
+		Select("room_id, COUNT(*) AS count").
+		Where("room_id IN ?", ids).
+		Group("room_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	memberCounts := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		memberCounts[c.RoomID] = c.Count
+	}
+
+	byID := make(map[uint]*room.Room)
+	for _, rm := range rooms {
+		rm.MemberCount = memberCounts[rm.ID]
+		rm.Large = r.limits.IsLarge(rm.Type, rm.MemberCount)
+		rm.Members = []user.User{}
+		if !rm.Large && rm.MemberCount > 0 {
+			byID[rm.ID] = rm
+		}
+	}
+	if len(byID) == 0 {
+		return nil
+	}
+	ids = ids[:0]
+	for id := range byID {
+		ids = append(ids, id)
+	}
+
+	var rows []struct {
+		user.User
+		RoomID uint
+	}
+	if err := r.db.Model(&user.User{}).
+		Select("users.*, room_members.room_id").
+		Joins("JOIN room_members ON room_members.user_id = users.id").
+		Where("room_members.room_id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		rm := byID[row.RoomID]
+		rm.Members = append(rm.Members, row.User)
+	}
+	return nil
+}
+
+func (r *roomRepo) ListMembers(roomID uint, limit int, offset int) ([]room.MemberInfo, error) {
+	var rows []struct {
+		user.User
+		Role     room.Role
+		JoinedAt time.Time
+	}
+	err := r.db.Model(&user.User{}).
+		Select("users.*, room_members.role, room_members.joined_at").
+		Joins("JOIN room_members ON room_members.user_id = users.id").
+		Where("room_members.room_id = ?", roomID).
+		Order(clause.Expr{SQL: "FIELD(room_members.role, ?, ?) DESC, room_members.joined_at, users.id", Vars: []interface{}{room.RoleAdmin, room.RoleOwner}}).
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	members := make([]room.MemberInfo, len(rows))
+	for i, row := range rows {
+		role := row.Role
+		if role == "" {
+			role = room.RoleMember
+		}
+		members[i] = room.MemberInfo{User: row.User.ToResponse(), Role: role, JoinedAt: row.JoinedAt}
+	}
+	return members, nil
 }
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *RoomHandler) SetAnnouncement(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		Content string          `json:"content" binding:"required"`
+		Format  chat.TextFormat `json:"format"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, err := h.roomApp.SetAnnouncement(uint(roomID), userID, req.Content, req.Format)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	announcement := rm.Announcement.ToResponse()
+	h.publishAnnouncement(rm.ID, announcement)
+
+	utils.Success(c, announcement)
+}
+
+func (h *RoomHandler) ClearAnnouncement(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	if err := h.roomApp.ClearAnnouncement(uint(roomID), userID); err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	h.publishAnnouncement(uint(roomID), nil)
+
+	utils.Message(c, "announcement removed")
+}
+
+func (h *RoomHandler) AcknowledgeAnnouncement(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	if err := h.roomApp.AcknowledgeAnnouncement(uint(roomID), userID); err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Message(c, "announcement acknowledged")
+}
+
+// publishAnnouncement pushes the new announcement to every member, or null
+// when it was removed. Nobody has acknowledged a fresh edit yet.
+func (h *RoomHandler) publishAnnouncement(roomID uint, announcement *room.AnnouncementResponse) {
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "announcement_updated",
+		"data": map[string]interface{}{
+			"room_id":      roomID,
+			"announcement": announcement,
+		},
+	})
+	h.hub.PublishToRedis(roomID, "announcement_updated", notification)
+}
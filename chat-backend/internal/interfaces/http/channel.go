@@ -0,0 +1,56 @@
+package http
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListChannels searches public channels: ?q= matches name or description,
+// paged with ?limit= and ?offset=.
+func (h *RoomHandler) ListChannels(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	channels, err := h.roomApp.ListChannels(userID, c.Query("q"), limit, offset)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, channels)
+}
+
+func (h *RoomHandler) JoinChannel(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	rm, msgs, err := h.roomApp.JoinChannel(uint(roomID), userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	// Notify members so the room shows up for the new member; broadcast
+	// audiences are too large to tell about every subscriber
+	resp := rm.ToResponse()
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "room_created",
+		"data": map[string]interface{}{
+			"room": resp,
+		},
+	})
+	if rm.Type == room.RoomTypeBroadcast {
+		h.hub.PublishToUser(userID, notification)
+	} else if len(msgs) > 0 {
+		h.hub.PublishToRedis(rm.ID, "room_created", notification)
+		h.hub.PublishMessages(msgs)
+	}
+
+	utils.Success(c, resp)
+}
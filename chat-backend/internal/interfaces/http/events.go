@@ -0,0 +1,167 @@
+package http
+
+import (
+	"chat-backend/internal/interfaces/ws"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPollTimeout = 25 * time.Second
+	maxPollTimeout     = 55 * time.Second
+	sseHeartbeat       = 20 * time.Second
+	maxSendSize        = 512 * 1024
+)
+
+// EventsHandler serves the real-time event stream to clients that cannot
+// open a WebSocket (proxies stripping the upgrade). Both transports register
+// a virtual client with the hub and accept frames through Send.
+type EventsHandler struct {
+	hub *ws.Hub
+}
+
+func NewEventsHandler(hub *ws.Hub) *EventsHandler {
+	return &EventsHandler{hub: hub}
+}
+
+// IssueTicket returns a short-lived, single-use ticket for opening the event
+// stream with ?ticket= where the Authorization header cannot be set.
+func (h *EventsHandler) IssueTicket(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	ticket, err := h.hub.IssueStreamTicket(userID)
+	if err != nil {
+		utils.ErrorWithCode(c, http.StatusInternalServerError, xerror.CodeInternalError, "Failed to issue ticket")
+		return
+	}
+	utils.Success(c, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(ws.StreamTicketTTL.Seconds()),
+	})
+}
+
+// Stream delivers events as Server-Sent Events. The first event is the
+// welcome frame carrying the session_id to use with Send.
+func (h *EventsHandler) Stream(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	version, xerr := ws.NegotiateVersion(c.Query("v"))
+	if xerr != nil {
+		utils.Error(c, http.StatusBadRequest, xerr)
+		return
+	}
+
+	session := h.hub.OpenSession(userID, version)
+	defer h.hub.CloseSession(session)
+	events, detach := session.Attach()
+	defer detach()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case item, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := session.Encode(item)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// Poll is the long-polling variant. Without a session it opens one; the
+// response carries the session_id for the next poll and for Send.
+func (h *EventsHandler) Poll(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	timeout := defaultPollTimeout
+	if s := c.Query("timeout"); s != "" {
+		secs, err := strconv.Atoi(s)
+		if err != nil || secs < 0 {
+			utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, "Invalid timeout")
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+		if timeout > maxPollTimeout {
+			timeout = maxPollTimeout
+		}
+	}
+
+	var session *ws.Session
+	if id := c.Query("session"); id != "" {
+		var ok bool
+		session, ok = h.hub.Session(id, userID)
+		if !ok {
+			utils.ErrorWithCode(c, http.StatusNotFound, xerror.CodeNotFound, "Session expired")
+			return
+		}
+	} else {
+		version, xerr := ws.NegotiateVersion(c.Query("v"))
+		if xerr != nil {
+			utils.Error(c, http.StatusBadRequest, xerr)
+			return
+		}
+		session = h.hub.OpenSession(userID, version)
+	}
+
+	events, closed := session.Poll(c.Request.Context(), timeout)
+	if closed && len(events) == 0 {
+		utils.ErrorWithCode(c, http.StatusNotFound, xerror.CodeNotFound, "Session expired")
+		return
+	}
+	if events == nil {
+		events = []json.RawMessage{}
+	}
+	utils.Success(c, gin.H{
+		"session_id": session.ID,
+		"events":     events,
+	})
+}
+
+// Send accepts one client frame, in the same format as on the WebSocket.
+// The ack or error frame is delivered on the session's event stream.
+func (h *EventsHandler) Send(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	session, ok := h.hub.Session(c.Query("session"), userID)
+	if !ok {
+		utils.ErrorWithCode(c, http.StatusNotFound, xerror.CodeNotFound, "Session expired")
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSendSize+1))
+	if err != nil || len(raw) == 0 || len(raw) > maxSendSize {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, "Invalid frame")
+		return
+	}
+
+	h.hub.Submit(session, raw)
+	c.JSON(http.StatusAccepted, utils.Response{Code: xerror.CodeOK})
+}
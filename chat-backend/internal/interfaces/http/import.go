@@ -0,0 +1,78 @@
+package http
+
+import (
+	"chat-backend/internal/app/command"
+	"chat-backend/internal/interfaces/ws"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Max 200MB per import archive
+const maxImportSize = 200 * 1024 * 1024
+
+type ImportHandler struct {
+	importApp *command.ImportHandler
+	hub       *ws.Hub
+}
+
+func NewImportHandler(importApp *command.ImportHandler, hub *ws.Hub) *ImportHandler {
+	return &ImportHandler{importApp: importApp, hub: hub}
+}
+
+// ImportRoom accepts a multipart upload with:
+//   - file:    export.json, or a zip containing export.json / a Slack export
+//   - format:  "gochat" (default) or "slack"
+//   - name:    optional name for the new room
+//   - channel: Slack channel to import when the export holds several
+func (h *ImportHandler) ImportRoom(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, "no file uploaded")
+		return
+	}
+	if fileHeader.Size > maxImportSize {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, "import archive exceeds 200MB limit")
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.ErrorWithCode(c, http.StatusInternalServerError, xerror.CodeInternalError, "failed to read upload")
+		return
+	}
+	defer file.Close()
+
+	opts := command.ImportOptions{
+		Format:   command.ImportFormat(c.DefaultPostForm("format", string(command.ImportFormatGoChat))),
+		RoomName: c.PostForm("name"),
+		Channel:  c.PostForm("channel"),
+	}
+
+	result, err := h.importApp.Import(userID, file, fileHeader.Size, fileHeader.Filename, opts)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusBadRequest), err)
+		return
+	}
+
+	// Notify members via WebSocket
+	resp := result.Room.ToResponse()
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "room_created",
+		"data": map[string]interface{}{
+			"room": resp,
+		},
+	})
+	h.hub.PublishToRedis(result.Room.ID, "room_created", notification)
+	publishInvitations(h.hub, result.Room, result.Invitations)
+
+	utils.Success(c, gin.H{
+		"room":   resp,
+		"result": result,
+	})
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/interfaces/ws"
+	"chat-backend/pkg/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *RoomHandler) ListInvitations(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	invitations, err := h.roomApp.ListInvitations(userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, invitations)
+}
+
+func (h *RoomHandler) AcceptInvitation(c *gin.Context) {
+	h.respondInvitation(c, true)
+}
+
+func (h *RoomHandler) DeclineInvitation(c *gin.Context) {
+	h.respondInvitation(c, false)
+}
+
+func (h *RoomHandler) respondInvitation(c *gin.Context, accept bool) {
+	userID := c.MustGet("user_id").(uint)
+	invitationIDStr := c.Param("id")
+	invitationID, _ := strconv.ParseUint(invitationIDStr, 10, 32)
+
+	invitation, rm, msgs, err := h.roomApp.RespondInvitation(uint(invitationID), userID, accept)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "room_invitation_answered",
+		"data": map[string]interface{}{
+			"invitation": invitation,
+		},
+	})
+	h.hub.PublishToUser(invitation.InviterID, event)
+
+	if !accept {
+		utils.Success(c, gin.H{"invitation": invitation})
+		return
+	}
+
+	resp := rm.ToResponse()
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "room_created",
+		"data": map[string]interface{}{
+			"room": resp,
+		},
+	})
+	h.hub.PublishToRedis(rm.ID, "room_created", notification)
+	h.hub.PublishMessages(msgs)
+
+	utils.Success(c, gin.H{"invitation": invitation, "room": resp})
+}
+
+// publishInvitations sends each invitee a room_invitation event.
+func (h *RoomHandler) publishInvitations(rm *room.Room, invitations []room.Invitation) {
+	publishInvitations(h.hub, rm, invitations)
+}
+
+// publishInvitations sends each invitee a room_invitation event.
+func publishInvitations(hub *ws.Hub, rm *room.Room, invitations []room.Invitation) {
+	for _, invitation := range invitations {
+		event, _ := json.Marshal(map[string]interface{}{
+			"type": "room_invitation",
+			"data": map[string]interface{}{
+				"invitation": invitation,
+				"room": map[string]interface{}{
+					"id":           rm.ID,
+					"name":         rm.Name,
+					"avatar":       rm.Avatar,
+					"member_count": rm.MemberCount,
+				},
+			},
+		})
+		hub.PublishToUser(invitation.InviteeID, event)
+	}
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"chat-backend/internal/app/command"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/interfaces/ws"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InviteHandler struct {
+	inviteApp *command.InviteHandler
+	hub       *ws.Hub
+}
+
+func NewInviteHandler(inviteApp *command.InviteHandler, hub *ws.Hub) *InviteHandler {
+	return &InviteHandler{inviteApp: inviteApp, hub: hub}
+}
+
+type inviteResponse struct {
+	room.Invite
+	Link string `json:"link"`
+}
+
+func newInviteResponse(invite room.Invite) inviteResponse {
+	return inviteResponse{Invite: invite, Link: command.InviteLink(invite.Token)}
+}
+
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		ExpiresIn        int  `json:"expires_in"` // seconds, 0 never expires
+		MaxUses          int  `json:"max_uses"`
+		RequiresApproval bool `json:"requires_approval"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	invite, err := h.inviteApp.CreateInvite(uint(roomID), userID, command.InviteOptions{
+		ExpiresIn:        time.Duration(req.ExpiresIn) * time.Second,
+		MaxUses:          req.MaxUses,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, newInviteResponse(*invite))
+}
+
+func (h *InviteHandler) ListInvites(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	invites, err := h.inviteApp.ListInvites(uint(roomID), userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	responses := make([]inviteResponse, len(invites))
+	for i, invite := range invites {
+		responses[i] = newInviteResponse(invite)
+	}
+	utils.Success(c, responses)
+}
+
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	inviteIDStr := c.Param("invite_id")
+	inviteID, _ := strconv.ParseUint(inviteIDStr, 10, 32)
+
+	if err := h.inviteApp.RevokeInvite(uint(roomID), uint(inviteID), userID); err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Message(c, "invite revoked")
+}
+
+func (h *InviteHandler) GetQRCode(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	inviteIDStr := c.Param("invite_id")
+	inviteID, _ := strconv.ParseUint(inviteIDStr, 10, 32)
+
+	png, err := h.inviteApp.InviteQRCode(uint(roomID), uint(inviteID), userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+func (h *InviteHandler) GetInvite(c *gin.Context) {
+	invite, rm, err := h.inviteApp.Preview(c.Param("token"))
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, gin.H{
+		"room_id":           rm.ID,
+		"room_name":         rm.Name,
+		"room_avatar":       rm.Avatar,
+		"member_count":      rm.MemberCount,
+		"requires_approval": invite.RequiresApproval,
+		"expires_at":        invite.ExpiresAt,
+	})
+}
+
+// JoinByInvite joins the group, or files a join request when the invite
+// requires approval (202 with the pending request). The body is optional:
+// {"note": "..."} for the admins reviewing the request.
+func (h *InviteHandler) JoinByInvite(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+			return
+		}
+	}
+
+	result, err := h.inviteApp.Join(c.Param("token"), userID, req.Note)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	rm := result.Room
+
+	if result.JoinRequest != nil {
+		publishJoinRequest(h.hub, rm, result.JoinRequest)
+		c.JSON(http.StatusAccepted, utils.Response{
+			Code: xerror.CodeOK,
+			Data: gin.H{"join_request": result.JoinRequest},
+		})
+		return
+	}
+
+	// Notify members so the room shows up for the new member
+	resp := rm.ToResponse()
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "room_created",
+		"data": map[string]interface{}{
+			"room": resp,
+		},
+	})
+	h.hub.PublishToRedis(rm.ID, "room_created", notification)
+	h.hub.PublishMessages(result.Messages)
+
+	utils.Success(c, resp)
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"chat-backend/internal/app/command"
+	"chat-backend/internal/domain/room"
+	"chat-backend/internal/interfaces/ws"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JoinRequestHandler struct {
+	joinRequestApp *command.JoinRequestHandler
+	hub            *ws.Hub
+}
+
+func NewJoinRequestHandler(joinRequestApp *command.JoinRequestHandler, hub *ws.Hub) *JoinRequestHandler {
+	return &JoinRequestHandler{joinRequestApp: joinRequestApp, hub: hub}
+}
+
+// SubmitRequest asks to join a public channel that requires approval and
+// answers 202 with the pending request. The body is optional: {"note": "..."}
+// for the admins reviewing it.
+func (h *JoinRequestHandler) SubmitRequest(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var body struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+			return
+		}
+	}
+
+	req, rm, err := h.joinRequestApp.Request(uint(roomID), userID, body.Note)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	publishJoinRequest(h.hub, rm, req)
+	c.JSON(http.StatusAccepted, utils.Response{
+		Code: xerror.CodeOK,
+		Data: gin.H{"join_request": req},
+	})
+}
+
+func (h *JoinRequestHandler) ListRequests(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	reqs, err := h.joinRequestApp.ListRequests(uint(roomID), userID, room.JoinRequestStatus(c.Query("status")))
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, reqs)
+}
+
+func (h *JoinRequestHandler) ApproveRequest(c *gin.Context) {
+	h.review(c, true)
+}
+
+func (h *JoinRequestHandler) RejectRequest(c *gin.Context) {
+	h.review(c, false)
+}
+
+func (h *JoinRequestHandler) review(c *gin.Context, approve bool) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	requestIDStr := c.Param("request_id")
+	requestID, _ := strconv.ParseUint(requestIDStr, 10, 32)
+
+	req, rm, msgs, err := h.joinRequestApp.Review(uint(roomID), uint(requestID), userID, approve)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	// Tell the applicant and clear the request from other admins' queues
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "join_request_reviewed",
+		"data": map[string]interface{}{
+			"request":   req,
+			"room_name": rm.Name,
+		},
+	})
+	h.hub.PublishToUser(req.UserID, event)
+	for _, adminID := range rm.Admins() {
+		h.hub.PublishToUser(adminID, event)
+	}
+
+	if approve {
+		notification, _ := json.Marshal(map[string]interface{}{
+			"type": "room_created",
+			"data": map[string]interface{}{
+				"room": rm.ToResponse(),
+			},
+		})
+		h.hub.PublishToRedis(rm.ID, "room_created", notification)
+		h.hub.PublishMessages(msgs)
+	}
+
+	utils.Success(c, req)
+}
+
+// publishJoinRequest notifies the room's owner and admins of a new request.
+func publishJoinRequest(hub *ws.Hub, rm *room.Room, req *room.JoinRequest) {
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "join_request",
+		"data": map[string]interface{}{
+			"request":   req,
+			"room_name": rm.Name,
+		},
+	})
+	for _, adminID := range rm.Admins() {
+		hub.PublishToUser(adminID, event)
+	}
+}
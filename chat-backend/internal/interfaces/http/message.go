@@ -25,6 +25,7 @@ func NewMessageHandler(messageApp *command.MessageHandler, hub *ws.Hub) *Message
 }
 
 func (h *MessageHandler) GetMessages(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
 	roomIDStr := c.Param("id")
 	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
 	
@@ -44,9 +45,30 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 		offset, _ = strconv.Atoi(offsetStr)
 	}
 
-	messages, err := h.messageApp.GetMessages(uint(roomID), limit, offset)
+	messages, err := h.messageApp.GetMessages(userID, uint(roomID), limit, offset)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	responses := make([]interface{}, len(messages))
+	for i, m := range messages {
+		responses[i] = m.ToResponse()
+	}
+	utils.Success(c, responses)
+}
+
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	limitStr := c.DefaultQuery("limit", "50")
+	limit, _ := strconv.Atoi(limitStr)
+
+	messages, err := h.messageApp.SearchMessages(userID, uint(roomID), c.Query("q"), limit)
 	if err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
 
@@ -69,7 +91,7 @@ func (h *MessageHandler) MarkAsRead(c *gin.Context) {
 	}
 
 	if err := h.messageApp.MarkAsRead(req.RoomID, userID, req.MessageID); err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
 
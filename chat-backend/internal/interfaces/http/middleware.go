@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"chat-backend/internal/interfaces/ws"
 	"chat-backend/pkg/logger"
 	"chat-backend/pkg/utils"
 	"chat-backend/pkg/xerror"
@@ -34,8 +35,10 @@ func LoggerMiddleware() gin.HandlerFunc {
 		isUpload := strings.Contains(path, "/messages/upload")
 		isStatic := strings.HasPrefix(path, "/uploads")
 		isMultipart := strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data")
+		// Event streams are long-lived, buffering their body would grow without bound
+		isStream := strings.HasPrefix(path, "/api/events")
 		
-		skipBody := isUpload || isStatic || isMultipart
+		skipBody := isUpload || isStatic || isMultipart || isStream
 
 		// Read Request Body only if not skipping
 		var requestBody []byte
@@ -116,3 +119,24 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// StreamAuthMiddleware is AuthMiddleware for event-stream routes. Browsers'
+// EventSource cannot set headers, so a single-use ticket from
+// POST /api/events/ticket is also accepted as ?ticket=.
+func StreamAuthMiddleware(secret string, hub *ws.Hub) gin.HandlerFunc {
+	auth := AuthMiddleware(secret)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" || c.Query("ticket") == "" {
+			auth(c)
+			return
+		}
+		userID, ok := hub.RedeemStreamTicket(c.Query("ticket"))
+		if !ok {
+			utils.ErrorWithCode(c, http.StatusUnauthorized, xerror.CodeUnauthorized, "Invalid or expired ticket")
+			c.Abort()
+			return
+		}
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
@@ -10,20 +10,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type RoomHandler struct {
 	roomApp *command.RoomHandler
-	db      *gorm.DB
 	hub     *ws.Hub
 }
 
-func NewRoomHandler(roomApp *command.RoomHandler, db *gorm.DB, hub *ws.Hub) *RoomHandler {
-	return &RoomHandler{roomApp: roomApp, db: db, hub: hub}
+func NewRoomHandler(roomApp *command.RoomHandler, hub *ws.Hub) *RoomHandler {
+	return &RoomHandler{roomApp: roomApp, hub: hub}
 }
 
 func (h *RoomHandler) CreateRoom(c *gin.Context) {
@@ -38,11 +35,12 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		return
 	}
 
-	rm, err := h.roomApp.CreateRoom(userID, req.Name, req.Type, req.MemberIDs)
+	rm, result, err := h.roomApp.CreateRoom(userID, req.Name, req.Type, req.MemberIDs)
 	if err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
+	h.publishInvitations(rm, result.Invitations)
 
 	// Notify members via WebSocket
 	resp := rm.ToResponse()
@@ -53,63 +51,22 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		},
 	})
 	h.hub.PublishToRedis(rm.ID, "room_created", notification)
+	h.hub.PublishMessages(result.Messages)
 
 	utils.Success(c, resp)
 }
 
 func (h *RoomHandler) GetRooms(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
-	rooms, err := h.roomApp.GetRooms(userID)
+	rooms, summaries, err := h.roomApp.GetRooms(userID, c.Query("archived") == "true")
 	if err != nil {
 		utils.Error(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	responses := make([]room.RoomResponse, len(rooms))
-	for i, rm := range rooms {
-		resp := rm.ToResponse()
-		
-		// 1. Get Read Status for all members in this room
-		var readReceipts []chat.ReadReceipt
-		h.db.Table("read_receipts").Where("room_id = ?", rm.ID).Find(&readReceipts)
-		resp.ReadStatus = readReceipts
-
-		// 2. Count unread messages for current user
-		var lastReadID uint
-		for _, r := range readReceipts {
-			if r.UserID == userID {
-				lastReadID = r.LastReadMessageID
-				break
-			}
-		}
-
-		var count int64
-		h.db.Table("messages").
-			Where("room_id = ? AND sender_id != ? AND id > ?", rm.ID, userID, lastReadID).
-			Count(&count)
-		resp.UnreadCount = count
-
-		// 3. Get last message
-		var lastMsg struct {
-			ID        uint      `json:"id"`
-			Content   string    `json:"content"`
-			CreatedAt time.Time `json:"created_at"`
-			SenderID  uint      `json:"sender_id"`
-			Sender    struct {
-				Username string `json:"username"`
-				Nickname string `json:"nickname"`
-			} `json:"sender" gorm:"-"`
-		}
-		if err := h.db.Table("messages").
-			Where("room_id = ?", rm.ID).
-			Order("created_at DESC").
-			First(&lastMsg).Error; err == nil {
-			// Fetch sender info for last message
-			h.db.Table("users").Select("username, nickname").Where("id = ?", lastMsg.SenderID).First(&lastMsg.Sender)
-			resp.LastMessage = lastMsg
-		}
-
-		responses[i] = resp
+	for i := range rooms {
+		responses[i] = viewerResponse(&rooms[i], userID, summaries[rooms[i].ID])
 	}
 	utils.Success(c, responses)
 }
@@ -119,31 +76,30 @@ func (h *RoomHandler) GetRoom(c *gin.Context) {
 	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
 	userID := c.MustGet("user_id").(uint)
 
-	rm, err := h.roomApp.GetRoom(uint(roomID))
+	rm, summary, err := h.roomApp.GetRoom(uint(roomID), userID)
 	if err != nil {
-		utils.Error(c, http.StatusNotFound, err)
+		utils.Error(c, utils.StatusFromError(err, http.StatusNotFound), err)
 		return
 	}
-	
+	utils.Success(c, viewerResponse(rm, userID, summary))
+}
+
+// viewerResponse is the room as userID sees it in their conversation list.
+func viewerResponse(rm *room.Room, userID uint, summary *chat.RoomSummary) room.RoomResponse {
 	resp := rm.ToResponse()
-	// Get Read Status
-	var readReceipts []chat.ReadReceipt
-	h.db.Table("read_receipts").Where("room_id = ?", rm.ID).Find(&readReceipts)
-	resp.ReadStatus = readReceipts
-
-	// Count unread
-	var lastReadID uint
-	for _, r := range readReceipts {
-		if r.UserID == userID {
-			lastReadID = r.LastReadMessageID
-			break
+	if resp.Announcement != nil {
+		resp.Announcement.Acknowledged = rm.AnnouncementAcknowledged(userID)
+	}
+	settings := rm.SettingsOf(userID)
+	resp.Settings = &settings
+	if summary != nil {
+		resp.ReadStatus = summary.ReadStatus
+		resp.UnreadCount = summary.UnreadCount
+		if summary.LastMessage != nil {
+			resp.LastMessage = summary.LastMessage
 		}
 	}
-	h.db.Table("messages").
-		Where("room_id = ? AND sender_id != ? AND id > ?", rm.ID, userID, lastReadID).
-		Count(&resp.UnreadCount)
-
-	utils.Success(c, resp)
+	return resp
 }
 
 func (h *RoomHandler) DeleteRoom(c *gin.Context) {
@@ -152,7 +108,7 @@ func (h *RoomHandler) DeleteRoom(c *gin.Context) {
 	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
 
 	if err := h.roomApp.DeleteRoom(uint(roomID), userID); err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
 	utils.Message(c, "room deleted or hidden")
@@ -171,11 +127,28 @@ func (h *RoomHandler) AddMembers(c *gin.Context) {
 		return
 	}
 
-	if err := h.roomApp.AddMembers(uint(roomID), userID, req.MemberIDs); err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+	result, err := h.roomApp.AddMembers(uint(roomID), userID, req.MemberIDs)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
-	utils.Message(c, "members added")
+	if len(result.Invitations) > 0 || len(result.Added) > 0 {
+		if rm, _, err := h.roomApp.GetRoom(uint(roomID), userID); err == nil {
+			h.publishInvitations(rm, result.Invitations)
+			if len(result.Added) > 0 {
+				// Make the room appear for the new members
+				notification, _ := json.Marshal(map[string]interface{}{
+					"type": "room_created",
+					"data": map[string]interface{}{
+						"room": rm.ToResponse(),
+					},
+				})
+				h.hub.PublishToRedis(rm.ID, "room_created", notification)
+			}
+		}
+	}
+	h.hub.PublishMessages(result.Messages)
+	utils.Success(c, result)
 }
 
 func (h *RoomHandler) RemoveMember(c *gin.Context) {
@@ -185,21 +158,119 @@ func (h *RoomHandler) RemoveMember(c *gin.Context) {
 	userIDStr := c.Param("user_id")
 	userID, _ := strconv.ParseUint(userIDStr, 10, 32)
 
-	if err := h.roomApp.RemoveMember(uint(roomID), operatorID, uint(userID)); err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+	msgs, err := h.roomApp.RemoveMember(uint(roomID), operatorID, uint(userID))
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
+	h.hub.PublishMessages(msgs)
 	utils.Message(c, "member removed")
 }
 
+func (h *RoomHandler) SetSlowMode(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		Seconds *int `json:"seconds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, err := h.roomApp.SetSlowMode(uint(roomID), userID, *req.Seconds)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, rm.ToResponse())
+}
+
+func (h *RoomHandler) SetMemberRole(c *gin.Context) {
+	operatorID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	userIDStr := c.Param("user_id")
+	userID, _ := strconv.ParseUint(userIDStr, 10, 32)
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, err := h.roomApp.SetMemberRole(uint(roomID), operatorID, uint(userID), room.Role(req.Role))
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "member_role_changed",
+		"data": map[string]interface{}{
+			"room_id": rm.ID,
+			"user_id": userID,
+			"role":    req.Role,
+		},
+	})
+	h.hub.PublishToRedis(rm.ID, "member_role_changed", notification)
+
+	utils.Success(c, rm.ToResponse())
+}
+
 func (h *RoomHandler) LeaveRoom(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 	roomIDStr := c.Param("id")
 	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
 
-	if err := h.roomApp.LeaveRoom(uint(roomID), userID); err != nil {
-		utils.Error(c, http.StatusInternalServerError, err)
+	result, err := h.roomApp.LeaveRoom(uint(roomID), userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
 		return
 	}
+	if result.NewOwnerID != 0 {
+		h.publishOwnerChanged(uint(roomID), userID, result.NewOwnerID)
+	}
+	h.hub.PublishMessages(result.Messages)
 	utils.Message(c, "left room")
 }
+
+func (h *RoomHandler) TransferOwnership(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, msgs, err := h.roomApp.TransferOwnership(uint(roomID), userID, req.UserID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	h.publishOwnerChanged(rm.ID, userID, req.UserID)
+	h.hub.PublishMessages(msgs)
+
+	utils.Success(c, rm.ToResponse())
+}
+
+func (h *RoomHandler) publishOwnerChanged(roomID, previousOwnerID, newOwnerID uint) {
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "owner_changed",
+		"data": map[string]interface{}{
+			"room_id":           roomID,
+			"previous_owner_id": previousOwnerID,
+			"owner_id":          newOwnerID,
+		},
+	})
+	h.hub.PublishToRedis(roomID, "owner_changed", notification)
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"chat-backend/pkg/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMembers pages through a room's members with ?limit= and ?offset=.
+func (h *RoomHandler) ListMembers(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	members, total, err := h.roomApp.ListMembers(uint(roomID), userID, limit, offset)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, gin.H{
+		"members": members,
+		"total":   total,
+	})
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *RoomHandler) MuteMember(c *gin.Context) {
+	operatorID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	userIDStr := c.Param("user_id")
+	userID, _ := strconv.ParseUint(userIDStr, 10, 32)
+
+	var req struct {
+		Duration *int `json:"duration" binding:"required"` // seconds, 0 unmutes
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	until, err := h.roomApp.MuteMember(uint(roomID), operatorID, uint(userID), time.Duration(*req.Duration)*time.Second)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "member_muted",
+		"data": map[string]interface{}{
+			"room_id":     roomID,
+			"user_id":     userID,
+			"muted_until": until,
+		},
+	})
+	h.hub.PublishToRedis(uint(roomID), "member_muted", notification)
+
+	utils.Success(c, gin.H{"user_id": userID, "muted_until": until})
+}
+
+func (h *RoomHandler) SetMuteAll(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		Muted *bool `json:"muted" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, err := h.roomApp.SetMuteAll(uint(roomID), userID, *req.Muted)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "room_mute_changed",
+		"data": map[string]interface{}{
+			"room_id":  rm.ID,
+			"mute_all": rm.MuteAll,
+		},
+	})
+	h.hub.PublishToRedis(rm.ID, "room_mute_changed", notification)
+
+	utils.Success(c, rm.ToResponse())
+}
+
+func (h *RoomHandler) BanMember(c *gin.Context) {
+	operatorID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		UserID uint   `json:"user_id" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	ban, msgs, err := h.roomApp.BanMember(uint(roomID), operatorID, req.UserID, req.Reason)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "member_banned",
+		"data": map[string]interface{}{
+			"room_id": ban.RoomID,
+			"user_id": ban.UserID,
+		},
+	})
+	h.hub.PublishToRedis(ban.RoomID, "member_banned", notification)
+	// The banned user is no longer in the room, tell them directly
+	h.hub.PublishToUser(ban.UserID, notification)
+	h.hub.PublishMessages(msgs)
+
+	utils.Success(c, ban)
+}
+
+func (h *RoomHandler) UnbanMember(c *gin.Context) {
+	operatorID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+	userIDStr := c.Param("user_id")
+	userID, _ := strconv.ParseUint(userIDStr, 10, 32)
+
+	if err := h.roomApp.UnbanMember(uint(roomID), operatorID, uint(userID)); err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]interface{}{
+		"type": "member_unbanned",
+		"data": map[string]interface{}{
+			"room_id": roomID,
+			"user_id": userID,
+		},
+	})
+	h.hub.PublishToRedis(uint(roomID), "member_unbanned", notification)
+
+	utils.Message(c, "user unbanned")
+}
+
+func (h *RoomHandler) ListBans(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	bans, err := h.roomApp.ListBans(uint(roomID), userID)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Success(c, bans)
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"chat-backend/internal/app/command"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *RoomHandler) UpdateSettings(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		NotifyMuted      *bool      `json:"notify_muted"`
+		NotifyMutedUntil *time.Time `json:"notify_muted_until"`
+		PinOrder         *int       `json:"pin_order"`
+		Alias            *string    `json:"alias"`
+		Archived         *bool      `json:"archived"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	settings, err := h.roomApp.UpdateSettings(uint(roomID), userID, command.SettingsUpdate{
+		NotifyMuted:      req.NotifyMuted,
+		NotifyMutedUntil: req.NotifyMutedUntil,
+		PinOrder:         req.PinOrder,
+		Alias:            req.Alias,
+		Archived:         req.Archived,
+	})
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	// Sync the user's other devices
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "room_settings_updated",
+		"data": map[string]interface{}{
+			"room_id":  roomID,
+			"settings": settings,
+		},
+	})
+	h.hub.PublishToUser(userID, event)
+
+	utils.Success(c, settings)
+}
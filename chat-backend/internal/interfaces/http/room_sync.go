@@ -0,0 +1,48 @@
+package http
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SyncRooms sends the changes to the caller's conversation list since the
+// version in ?since=, so reconnecting clients need not refetch every room.
+func (h *RoomHandler) SyncRooms(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var since uint64
+	if s := c.Query("since"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, "invalid since version")
+			return
+		}
+		since = v
+	}
+
+	result, err := h.roomApp.SyncRooms(userID, since)
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	responses := make([]room.RoomResponse, len(result.Rooms))
+	for i := range result.Rooms {
+		responses[i] = viewerResponse(&result.Rooms[i], userID, result.Summaries[result.Rooms[i].ID])
+	}
+	removed := result.Removed
+	if removed == nil {
+		removed = []uint{}
+	}
+	utils.Success(c, gin.H{
+		"version": result.Version,
+		"full":    result.Full,
+		"rooms":   responses,
+		"removed": removed,
+	})
+}
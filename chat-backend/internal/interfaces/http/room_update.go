@@ -0,0 +1,60 @@
+package http
+
+import (
+	"chat-backend/internal/app/command"
+	"chat-backend/pkg/utils"
+	"chat-backend/pkg/xerror"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *RoomHandler) UpdateRoom(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	roomIDStr := c.Param("id")
+	roomID, _ := strconv.ParseUint(roomIDStr, 10, 32)
+
+	var req struct {
+		Name        *string `json:"name"`
+		Avatar      *string `json:"avatar"`
+		Description *string `json:"description"`
+		Settings    struct {
+			SlowMode     *int  `json:"slow_mode"`
+			MuteAll      *bool `json:"mute_all"`
+			JoinApproval *bool `json:"join_approval"`
+		} `json:"settings"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rm, msgs, err := h.roomApp.UpdateRoom(uint(roomID), userID, command.RoomUpdate{
+		Name:         req.Name,
+		Avatar:       req.Avatar,
+		Description:  req.Description,
+		SlowMode:     req.Settings.SlowMode,
+		MuteAll:      req.Settings.MuteAll,
+		JoinApproval: req.Settings.JoinApproval,
+	})
+	if err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	resp := rm.ToResponse()
+	if len(msgs) > 0 {
+		notification, _ := json.Marshal(map[string]interface{}{
+			"type": "room_updated",
+			"data": map[string]interface{}{
+				"room": resp,
+			},
+		})
+		h.hub.PublishToRedis(rm.ID, "room_updated", notification)
+		h.hub.PublishMessages(msgs)
+	}
+
+	utils.Success(c, resp)
+}
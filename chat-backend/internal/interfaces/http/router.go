@@ -4,6 +4,7 @@ import (
 	"chat-backend/internal/interfaces/ws"
 	"chat-backend/pkg/logger"
 	"chat-backend/pkg/utils"
+	"net/http"
 	"strconv"
 
 	"github.com/gin-contrib/cors"
@@ -13,12 +14,15 @@ import (
 )
 
 type RouterOptions struct {
-	AuthHandler    *AuthHandler
-	UserHandler    *UserHandler
-	RoomHandler    *RoomHandler
-	MessageHandler *MessageHandler
-	MarketHandler   *MarketHandler
-	Hub            *ws.Hub
+	AuthHandler        *AuthHandler
+	UserHandler        *UserHandler
+	RoomHandler        *RoomHandler
+	MessageHandler     *MessageHandler
+	MarketHandler      *MarketHandler
+	ImportHandler      *ImportHandler
+	InviteHandler      *InviteHandler
+	JoinRequestHandler *JoinRequestHandler
+	Hub                *ws.Hub
 }
 
 func NewRouter(opts RouterOptions) *gin.Engine {
@@ -63,18 +67,59 @@ func NewRouter(opts RouterOptions) *gin.Engine {
 			protected.PUT("/friend-groups/:id", opts.UserHandler.UpdateGroup)
 			protected.DELETE("/friend-groups/:id", opts.UserHandler.DeleteGroup)
 			protected.POST("/users/friends/set-group", opts.UserHandler.SetFriendGroup)
+			protected.PUT("/users/privacy", opts.UserHandler.UpdatePrivacy)
 
 			// Room routes
 			protected.POST("/rooms", opts.RoomHandler.CreateRoom)
+			protected.POST("/rooms/import", opts.ImportHandler.ImportRoom)
 			protected.GET("/rooms", opts.RoomHandler.GetRooms)
+			protected.GET("/rooms/sync", opts.RoomHandler.SyncRooms)
 			protected.GET("/rooms/:id", opts.RoomHandler.GetRoom)
+			protected.PATCH("/rooms/:id", opts.RoomHandler.UpdateRoom)
 			protected.DELETE("/rooms/:id", opts.RoomHandler.DeleteRoom)
 			protected.POST("/rooms/:id/leave", opts.RoomHandler.LeaveRoom)
+			protected.POST("/rooms/:id/transfer", opts.RoomHandler.TransferOwnership)
+			protected.GET("/rooms/:id/members", opts.RoomHandler.ListMembers)
 			protected.POST("/rooms/:id/members", opts.RoomHandler.AddMembers)
 			protected.DELETE("/rooms/:id/members/:user_id", opts.RoomHandler.RemoveMember)
+			protected.PUT("/rooms/:id/members/:user_id/role", opts.RoomHandler.SetMemberRole)
+			protected.PUT("/rooms/:id/slow-mode", opts.RoomHandler.SetSlowMode)
+			protected.PUT("/rooms/:id/settings", opts.RoomHandler.UpdateSettings)
+			protected.PUT("/rooms/:id/announcement", opts.RoomHandler.SetAnnouncement)
+			protected.DELETE("/rooms/:id/announcement", opts.RoomHandler.ClearAnnouncement)
+			protected.POST("/rooms/:id/announcement/ack", opts.RoomHandler.AcknowledgeAnnouncement)
+			protected.PUT("/rooms/:id/members/:user_id/mute", opts.RoomHandler.MuteMember)
+			protected.PUT("/rooms/:id/mute", opts.RoomHandler.SetMuteAll)
+			protected.GET("/rooms/:id/bans", opts.RoomHandler.ListBans)
+			protected.POST("/rooms/:id/bans", opts.RoomHandler.BanMember)
+			protected.DELETE("/rooms/:id/bans/:user_id", opts.RoomHandler.UnbanMember)
+
+			// Invite routes
+			protected.POST("/rooms/:id/invites", opts.InviteHandler.CreateInvite)
+			protected.GET("/rooms/:id/invites", opts.InviteHandler.ListInvites)
+			protected.DELETE("/rooms/:id/invites/:invite_id", opts.InviteHandler.RevokeInvite)
+			protected.GET("/rooms/:id/invites/:invite_id/qr", opts.InviteHandler.GetQRCode)
+			protected.GET("/invites/:token", opts.InviteHandler.GetInvite)
+			protected.POST("/invites/:token/join", opts.InviteHandler.JoinByInvite)
+
+			// Invitation routes
+			protected.GET("/invitations", opts.RoomHandler.ListInvitations)
+			protected.POST("/invitations/:id/accept", opts.RoomHandler.AcceptInvitation)
+			protected.POST("/invitations/:id/decline", opts.RoomHandler.DeclineInvitation)
+
+			// Channel routes
+			protected.GET("/channels", opts.RoomHandler.ListChannels)
+			protected.POST("/channels/:id/join", opts.RoomHandler.JoinChannel)
+
+			// Join request routes
+			protected.GET("/rooms/:id/join-requests", opts.JoinRequestHandler.ListRequests)
+			protected.POST("/rooms/:id/join-requests", opts.JoinRequestHandler.SubmitRequest)
+			protected.POST("/rooms/:id/join-requests/:request_id/approve", opts.JoinRequestHandler.ApproveRequest)
+			protected.POST("/rooms/:id/join-requests/:request_id/reject", opts.JoinRequestHandler.RejectRequest)
 
 			// Message routes
 			protected.GET("/rooms/:id/messages", opts.MessageHandler.GetMessages)
+			protected.GET("/rooms/:id/messages/search", opts.MessageHandler.SearchMessages)
 			protected.POST("/messages/upload", opts.MessageHandler.UploadFile)
 			protected.POST("/messages/read", opts.MessageHandler.MarkAsRead)
 
@@ -82,6 +127,18 @@ func NewRouter(opts RouterOptions) *gin.Engine {
 			protected.GET("/market/prices", opts.MarketHandler.GetPrices)
 			protected.GET("/market/history", opts.MarketHandler.GetHistory)
 		}
+
+		// Fallback transports for networks that block WebSocket upgrades.
+		// Tickets are issued on header auth only, so one cannot mint another.
+		eventsHandler := NewEventsHandler(opts.Hub)
+		protected.POST("/events/ticket", eventsHandler.IssueTicket)
+		events := api.Group("/events")
+		events.Use(StreamAuthMiddleware(jwtSecret, opts.Hub))
+		{
+			events.GET("", eventsHandler.Stream)
+			events.GET("/poll", eventsHandler.Poll)
+			events.POST("/send", eventsHandler.Send)
+		}
 	}
 
 	// WebSocket Route
@@ -106,6 +163,12 @@ func NewRouter(opts RouterOptions) *gin.Engine {
 			return
 		}
 
+		version, xerr := ws.NegotiateVersion(c.Query("v"))
+		if xerr != nil {
+			utils.Error(c, http.StatusBadRequest, xerr)
+			return
+		}
+
 		upgrader := ws.GetUpgrader()
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
@@ -113,7 +176,7 @@ func NewRouter(opts RouterOptions) *gin.Engine {
 			return
 		}
 
-		client := ws.NewClient(opts.Hub, conn, uint(userID))
+		client := ws.NewClient(opts.Hub, conn, uint(userID), version, c.Query("batch") == "1")
 		opts.Hub.Register <- client
 
 		go client.WritePump()
@@ -2,6 +2,7 @@ package http
 
 import (
 	"chat-backend/internal/app/command"
+	"chat-backend/internal/domain/user"
 	"chat-backend/pkg/utils"
 	"chat-backend/pkg/xerror"
 	"net/http"
@@ -25,7 +26,26 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		utils.Error(c, http.StatusNotFound, err)
 		return
 	}
-	utils.Success(c, u.ToResponse())
+	resp := u.ToResponse()
+	resp.GroupInvitePolicy = u.InvitePolicy()
+	utils.Success(c, resp)
+}
+
+func (h *UserHandler) UpdatePrivacy(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		GroupInvitePolicy string `json:"group_invite_policy" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorWithCode(c, http.StatusBadRequest, xerror.CodeInvalidParams, err.Error())
+		return
+	}
+
+	if err := h.userApp.UpdatePrivacy(userID, user.GroupInvitePolicy(req.GroupInvitePolicy)); err != nil {
+		utils.Error(c, utils.StatusFromError(err, http.StatusInternalServerError), err)
+		return
+	}
+	utils.Message(c, "privacy settings updated")
 }
 
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
@@ -0,0 +1,209 @@
+package ws
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/logger"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Broadcast channels can have tens of thousands of subscribers, so their
+// events are not delivered by loading the room's members. Each instance
+// instead indexes which of its connected users subscribe to which broadcast
+// rooms: the index is loaded when a user connects and kept current from the
+// membership changes the room repository announces over Redis.
+type broadcastIndex struct {
+	mu    sync.RWMutex
+	rooms map[uint]map[uint]struct{} // room -> locally connected subscribers
+	users map[uint][]uint            // subscriber -> rooms
+}
+
+func newBroadcastIndex() *broadcastIndex {
+	return &broadcastIndex{
+		rooms: make(map[uint]map[uint]struct{}),
+		users: make(map[uint][]uint),
+	}
+}
+
+// set replaces userID's subscriptions
+func (b *broadcastIndex) set(userID uint, roomIDs []uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropLocked(userID)
+	if len(roomIDs) == 0 {
+		return
+	}
+	b.users[userID] = roomIDs
+	for _, id := range roomIDs {
+		if b.rooms[id] == nil {
+			b.rooms[id] = make(map[uint]struct{})
+		}
+		b.rooms[id][userID] = struct{}{}
+	}
+}
+
+func (b *broadcastIndex) drop(userID uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropLocked(userID)
+}
+
+func (b *broadcastIndex) dropLocked(userID uint) {
+	for _, id := range b.users[userID] {
+		delete(b.rooms[id], userID)
+		if len(b.rooms[id]) == 0 {
+			delete(b.rooms, id)
+		}
+	}
+	delete(b.users, userID)
+}
+
+func (b *broadcastIndex) leave(roomID uint, userID uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.rooms[roomID][userID]; !ok {
+		return
+	}
+	delete(b.rooms[roomID], userID)
+	if len(b.rooms[roomID]) == 0 {
+		delete(b.rooms, roomID)
+	}
+	rooms := b.users[userID][:0]
+	for _, id := range b.users[userID] {
+		if id != roomID {
+			rooms = append(rooms, id)
+		}
+	}
+	b.users[userID] = rooms
+}
+
+func (b *broadcastIndex) dropRoom(roomID uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for userID := range b.rooms[roomID] {
+		rooms := b.users[userID][:0]
+		for _, id := range b.users[userID] {
+			if id != roomID {
+				rooms = append(rooms, id)
+			}
+		}
+		b.users[userID] = rooms
+	}
+	delete(b.rooms, roomID)
+}
+
+// subscribers returns a snapshot of roomID's local subscribers
+func (b *broadcastIndex) subscribers(roomID uint) []uint {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	ids := make([]uint, 0, len(b.rooms[roomID]))
+	for id := range b.rooms[roomID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// roomInfoTTL bounds how long a room's cached type and size are trusted,
+// should an update or membership change have been missed.
+const roomInfoTTL = time.Minute
+
+// roomInfo is what the hub needs to know about a room on every event,
+// cached in process: room updates and membership changes drop the entry.
+type roomInfo struct {
+	typ      room.RoomType
+	large    bool
+	loadedAt time.Time
+}
+
+func (h *Hub) roomInfo(roomID uint) *roomInfo {
+	if v, ok := h.roomInfos.Load(roomID); ok {
+		if info := v.(*roomInfo); time.Since(info.loadedAt) < roomInfoTTL {
+			return info
+		}
+	}
+	t, err := h.roomRepo.TypeOf(roomID)
+	if err != nil {
+		logger.L.Error("failed to load room type", zap.Error(err), zap.Uint("room_id", roomID))
+		return &roomInfo{}
+	}
+	info := &roomInfo{typ: t, large: t == room.RoomTypeBroadcast, loadedAt: time.Now()}
+	if !info.large {
+		count, err := h.roomRepo.MemberCount(roomID)
+		if err != nil {
+			logger.L.Error("failed to count room members", zap.Error(err), zap.Uint("room_id", roomID))
+			return info
+		}
+		info.large = h.limits.IsLarge(t, count)
+	}
+	h.roomInfos.Store(roomID, info)
+	return info
+}
+
+func (h *Hub) forgetRoom(roomID uint) {
+	h.roomInfos.Delete(roomID)
+}
+
+func (h *Hub) roomType(roomID uint) room.RoomType {
+	return h.roomInfo(roomID).typ
+}
+
+// isLarge reports whether roomID runs in large-group mode
+func (h *Hub) isLarge(roomID uint) bool {
+	return h.roomInfo(roomID).large
+}
+
+// loadSubscriptions indexes the broadcast rooms of a user connected here
+func (h *Hub) loadSubscriptions(userID uint) {
+	ids, err := h.roomRepo.RoomIDsByType(userID, room.RoomTypeBroadcast)
+	if err != nil {
+		logger.L.Error("failed to load broadcast subscriptions", zap.Error(err), zap.Uint("user_id", userID))
+		return
+	}
+	h.mu.RLock()
+	_, connected := h.clients[userID]
+	h.mu.RUnlock()
+	if connected {
+		h.broadcasts.set(userID, ids)
+	}
+}
+
+func (h *Hub) handleMembershipChange(redisMsg *redis.Message) {
+	var change room.MembershipChange
+	if err := json.Unmarshal([]byte(redisMsg.Payload), &change); err != nil {
+		return
+	}
+	h.forgetRoom(change.RoomID)
+	switch {
+	case change.UserID == 0:
+		h.broadcasts.dropRoom(change.RoomID)
+	case !change.Joined:
+		h.broadcasts.leave(change.RoomID, change.UserID)
+	default:
+		h.mu.RLock()
+		_, connected := h.clients[change.UserID]
+		h.mu.RUnlock()
+		if connected && h.roomType(change.RoomID) == room.RoomTypeBroadcast {
+			h.loadSubscriptions(change.UserID)
+		}
+	}
+}
+
+// deliverToSubscribers sends a broadcast room event to the room's
+// subscribers connected to this instance, silenced like deliverToMembers
+// for those who muted the room.
+func (h *Hub) deliverToSubscribers(roomID uint, msgType string, payload []byte) {
+	subscriberIDs := h.broadcasts.subscribers(roomID)
+	if len(subscriberIDs) == 0 {
+		return
+	}
+	h.deliverToMembers(roomID, subscriberIDs, msgType, payload)
+}
+
+func isMembershipChannel(channel string) bool {
+	return strings.HasPrefix(channel, room.MembershipChannelPrefix)
+}
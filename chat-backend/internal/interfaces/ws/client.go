@@ -13,21 +13,47 @@ const (
 	pongWait       = 30 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512 * 1024
+	// Max frames coalesced into one batch frame
+	maxBatchSize = 64
 )
 
 type Client struct {
 	Hub    *Hub
 	Conn   *websocket.Conn
 	UserID uint
-	send   chan []byte
+	// Version is the protocol version negotiated at connect time
+	Version int
+	codec   Codec
+	// batch coalesces queued frames into one batch frame per write
+	batch             bool
+	compressThreshold int
+	// sessionID is set for SSE / long-poll clients, which have no Conn
+	sessionID string
+	// send queues typed frames and relayed room events (json.RawMessage)
+	send chan interface{}
+	// registered is closed once the hub has registered the client, before
+	// which replies to its frames would be dropped
+	registered chan struct{}
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID uint) *Client {
+// NewClient wraps an upgraded connection. A negotiated subprotocol selects
+// the frame codec and overrides the requested version.
+func NewClient(hub *Hub, conn *websocket.Conn, userID uint, version int, batch bool) *Client {
+	codec := Codec(jsonCodec{})
+	if name := conn.Subprotocol(); name != "" {
+		version, codec = ParseSubprotocol(name)
+	}
 	return &Client{
-		Hub:    hub,
-		Conn:   conn,
-		UserID: userID,
-		send:   make(chan []byte, 256),
+		Hub:     hub,
+		Conn:    conn,
+		UserID:  userID,
+		Version: version,
+		codec:   codec,
+		batch:   batch,
+		send:    make(chan interface{}, 256),
+
+		registered:        make(chan struct{}),
+		compressThreshold: compressionThreshold(),
 	}
 }
 
@@ -37,6 +63,7 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
+	<-c.registered
 	c.Conn.SetReadLimit(maxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
@@ -55,11 +82,7 @@ func (c *Client) ReadPump() {
 		// 每次收到消息都重置读取超时时间
 		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 
-		// Handle message - ideally send to Hub or App layer
-		c.Hub.Broadcast <- &BroadcastMessage{
-			Client:  c,
-			Message: message,
-		}
+		c.Hub.handleIncomingMessage(c, message)
 	}
 }
 
@@ -79,7 +102,25 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			items := []interface{}{message}
+			closed := false
+			if c.batch {
+				// Drain whatever is already queued, without waiting for more
+				for n := len(c.send); n > 0 && len(items) < maxBatchSize; n-- {
+					next, ok := <-c.send
+					if !ok {
+						closed = true
+						break
+					}
+					items = append(items, next)
+				}
+			}
+
+			if err := c.write(items); err != nil {
+				return
+			}
+			if closed {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
@@ -91,3 +132,22 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// write encodes items as a single frame and compresses it when it is large
+// enough to benefit. Encoding failures drop the frame, not the connection.
+func (c *Client) write(items []interface{}) error {
+	var data []byte
+	var err error
+	if len(items) == 1 {
+		data, err = c.codec.Marshal(items[0])
+	} else {
+		data, err = c.codec.MarshalBatch(items)
+	}
+	if err != nil {
+		logger.L.Error("failed to encode frame", zap.Error(err), zap.String("codec", c.codec.Name()))
+		return nil
+	}
+
+	c.Conn.EnableWriteCompression(len(data) >= c.compressThreshold)
+	return c.Conn.WriteMessage(c.codec.FrameType(), data)
+}
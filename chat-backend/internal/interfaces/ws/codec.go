@@ -0,0 +1,176 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Codec encodes frames for one WebSocket subprotocol. Clients pick a codec
+// through Sec-WebSocket-Protocol ("gochat.v1.json", "gochat.v1.msgpack");
+// without one the connection speaks JSON text frames.
+//
+// Room events travel between instances as JSON over Redis and reach the
+// client queue as json.RawMessage; binary codecs transcode them once per
+// client write.
+type Codec interface {
+	Name() string
+	// FrameType is the WebSocket message type used for encoded frames
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	// MarshalBatch encodes several queued frames as one "batch" frame
+	MarshalBatch(items []interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const subprotocolPrefix = "gochat.v"
+
+// Subprotocols lists every supported subprotocol, preferred first.
+func Subprotocols() []string {
+	var names []string
+	for v := ProtocolVersion; v >= MinProtocolVersion; v-- {
+		for _, c := range codecs {
+			names = append(names, fmt.Sprintf("%s%d.%s", subprotocolPrefix, v, c.Name()))
+		}
+	}
+	return names
+}
+
+// ParseSubprotocol resolves a negotiated subprotocol. An empty name selects
+// JSON at the default version.
+func ParseSubprotocol(name string) (int, Codec) {
+	if !strings.HasPrefix(name, subprotocolPrefix) {
+		return ProtocolVersion, jsonCodec{}
+	}
+	versionStr, codecName, _ := strings.Cut(name[len(subprotocolPrefix):], ".")
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return ProtocolVersion, jsonCodec{}
+	}
+	for _, c := range codecs {
+		if c.Name() == codecName {
+			return version, c
+		}
+	}
+	return version, jsonCodec{}
+}
+
+var codecs = []Codec{msgpackCodec{}, jsonCodec{}}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string   { return "json" }
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+func (c jsonCodec) MarshalBatch(items []interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`{"type":"` + FrameBatch + `","data":[`)
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		data, err := c.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+	}
+	b.WriteString("]}")
+	return b.Bytes(), nil
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	// Reuse the json tags of the frame structs
+	h.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	return h
+}()
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string   { return "msgpack" }
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		decoded, err := decodeJSONValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		v = decoded
+	}
+	var out []byte
+	err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(v)
+	return out, err
+}
+
+func (c msgpackCodec) MarshalBatch(items []interface{}) ([]byte, error) {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		if raw, ok := item.(json.RawMessage); ok {
+			decoded, err := decodeJSONValue(raw)
+			if err != nil {
+				return nil, err
+			}
+			item = decoded
+		}
+		values[i] = item
+	}
+	return c.Marshal(Frame{Type: FrameBatch, Data: values})
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+// decodeJSONValue decodes a JSON document keeping integers as int64 so that
+// IDs are not turned into floats on the binary side.
+func decodeJSONValue(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
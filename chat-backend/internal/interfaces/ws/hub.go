@@ -1,13 +1,20 @@
 package ws
 
 import (
+	"chat-backend/internal/app/command"
 	"chat-backend/internal/domain/chat"
+	"chat-backend/internal/domain/moderation"
 	"chat-backend/internal/domain/room"
 	"chat-backend/internal/domain/user"
 	"chat-backend/pkg/logger"
+	"chat-backend/pkg/ratelimit"
+	"chat-backend/pkg/xerror"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/redis/go-redis/v9"
@@ -16,7 +23,6 @@ import (
 
 type Hub struct {
 	clients     map[uint]map[*Client]bool
-	Broadcast   chan *BroadcastMessage
 	Register    chan *Client
 	Unregister  chan *Client
 	mu          sync.RWMutex
@@ -24,29 +30,42 @@ type Hub struct {
 	roomRepo    room.Repository
 	userRepo    user.Repository
 	rdb         *redis.Client
+	moderation  *command.ModerationHandler
+	authz       *command.AuthzHandler
+	limiter     *ratelimit.Limiter
+	rateLimits  rateLimitConfig
+	sessions    sessionRegistry
+	typing      *typingTracker
+	broadcasts  *broadcastIndex
+	roomInfos   sync.Map // room id -> *roomInfo
+	limits      room.Limits
 }
 
-type BroadcastMessage struct {
-	Client  *Client
-	Message []byte
-}
-
-func NewHub(messageRepo chat.Repository, roomRepo room.Repository, userRepo user.Repository, rdb *redis.Client) *Hub {
+func NewHub(messageRepo chat.Repository, roomRepo room.Repository, userRepo user.Repository, rdb *redis.Client, moderation *command.ModerationHandler, authz *command.AuthzHandler, limits room.Limits) *Hub {
 	return &Hub{
 		clients:     make(map[uint]map[*Client]bool),
-		Broadcast:   make(chan *BroadcastMessage, 256),
 		Register:    make(chan *Client),
 		Unregister:  make(chan *Client),
 		messageRepo: messageRepo,
 		roomRepo:    roomRepo,
 		userRepo:    userRepo,
 		rdb:         rdb,
+		moderation:  moderation,
+		authz:       authz,
+		limiter:     ratelimit.New(rdb),
+		rateLimits:  loadRateLimitConfig(),
+		sessions:    sessionRegistry{sessions: make(map[string]*Session)},
+		typing:      newTypingTracker(),
+		broadcasts:  newBroadcastIndex(),
+		limits:      limits,
 	}
 }
 
 func (h *Hub) Run() {
 	// 5. Start Redis Subscription
 	go h.subscribeToRedis()
+	go h.sweepSessions()
+	go h.runTypingPublisher()
 
 	for {
 		select {
@@ -59,8 +78,19 @@ func (h *Hub) Run() {
 			}
 			h.clients[client.UserID][client] = true
 			h.mu.Unlock()
+			close(client.registered)
+
+			welcome := map[string]interface{}{
+				"protocol_version": client.Version,
+				"user_id":          client.UserID,
+			}
+			if client.sessionID != "" {
+				welcome["session_id"] = client.sessionID
+			}
+			h.sendFrame(client, Frame{Type: FrameWelcome, Data: welcome})
 
 			if isFirstClient {
+				go h.loadSubscriptions(client.UserID)
 				h.userRepo.UpdateStatus(client.UserID, "online")
 				h.broadcastUserStatus(client.UserID, "online")
 			}
@@ -82,28 +112,24 @@ func (h *Hub) Run() {
 			h.mu.Unlock()
 
 			if isLastClient {
+				h.broadcasts.drop(client.UserID)
 				h.userRepo.UpdateStatus(client.UserID, "offline")
 				h.broadcastUserStatus(client.UserID, "offline")
 			}
 			logger.L.Info("Client unregistered", zap.Uint("user_id", client.UserID))
 
-		case broadcast := <-h.Broadcast:
-			var msg map[string]interface{}
-			if err := json.Unmarshal(broadcast.Message, &msg); err != nil {
-				continue
-			}
-			h.handleIncomingMessage(broadcast.Client, broadcast.Message, msg)
 		}
 	}
 }
 
 func (h *Hub) subscribeToRedis() {
-	// Subscribe to both room messages and user status changes
-	pubsub := h.rdb.PSubscribe(context.Background(), "room:*", "user:status:*")
+	// Subscribe to room messages, user status changes, per-user events and
+	// membership changes
+	pubsub := h.rdb.PSubscribe(context.Background(), "room:*", "user:status:*", "user:notify:*", room.MembershipChannelPrefix+"*")
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
-	logger.L.Info("Subscribed to Redis channels room:* and user:status:*")
+	logger.L.Info("Subscribed to Redis channels room:*, user:status:*, user:notify:* and membership:*")
 
 	for msg := range ch {
 		h.handleRedisMessage(msg)
@@ -116,6 +142,17 @@ func (h *Hub) handleRedisMessage(redisMsg *redis.Message) {
 		h.handleUserStatusRelay(redisMsg)
 		return
 	}
+	if strings.HasPrefix(redisMsg.Channel, userNotifyPrefix) {
+		userID, err := strconv.ParseUint(redisMsg.Channel[len(userNotifyPrefix):], 10, 32)
+		if err == nil {
+			h.SendToUser(uint(userID), []byte(redisMsg.Payload))
+		}
+		return
+	}
+	if isMembershipChannel(redisMsg.Channel) {
+		h.handleMembershipChange(redisMsg)
+		return
+	}
 
 	var payload struct {
 		RoomID  uint            `json:"room_id"`
@@ -128,34 +165,78 @@ func (h *Hub) handleRedisMessage(redisMsg *redis.Message) {
 		return
 	}
 
+	if payload.Type == "room_updated" {
+		h.forgetRoom(payload.RoomID)
+	}
+	if h.roomType(payload.RoomID) == room.RoomTypeBroadcast {
+		h.deliverToSubscribers(payload.RoomID, payload.Type, payload.Payload)
+		return
+	}
+
 	// Fetch room members
-	rm, err := h.roomRepo.GetByID(payload.RoomID)
+	memberIDs, err := h.roomRepo.MemberIDs(payload.RoomID)
 	if err != nil {
 		logger.L.Error("failed to get room members from repo", zap.Error(err), zap.Uint("room_id", payload.RoomID))
 		return
 	}
 
-	if len(rm.Members) == 0 {
+	if len(memberIDs) == 0 {
 		return
 	}
 
-	for _, member := range rm.Members {
-		h.SendToUser(member.ID, []byte(payload.Payload))
-	}
+	h.deliverToMembers(payload.RoomID, memberIDs, payload.Type, payload.Payload)
 }
 
-func (h *Hub) handleIncomingMessage(client *Client, raw []byte, msg map[string]interface{}) {
-	msgType, _ := msg["type"].(string)
+// handleIncomingMessage handles a client frame. It runs on the client's own
+// read path, not the hub loop, so that a slow database or Redis call only
+// holds up the connection that made it; frames of one client are still
+// handled in order.
+func (h *Hub) handleIncomingMessage(client *Client, raw []byte) {
+	var env Envelope
+
+	// A bug in one handler must never take the connection down with it
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error("panic while handling frame",
+				zap.Any("panic", r),
+				zap.String("type", env.Type),
+				zap.Uint("user_id", client.UserID))
+			h.sendError(client, env.RequestID, xerror.New(xerror.CodeInternalError, "internal error"))
+		}
+	}()
+
+	if err := client.codec.Unmarshal(raw, &env); err != nil {
+		h.sendError(client, "", xerror.New(xerror.CodeInvalidParams, "malformed frame"))
+		return
+	}
 
-	switch msgType {
-	case "ping":
-		h.handlePing(client)
-	case "message":
-		h.handleChatMessage(client, msg)
-	case "typing":
-		h.handleTypingStatus(client, msg)
-	case "read_receipt":
-		h.handleReadReceipt(client, msg)
+	switch env.Type {
+	case OpPing:
+		h.handlePing(client, env)
+	case OpMessage:
+		var f ChatMessageFrame
+		if xerr := decodeFrame(client.codec, raw, &f); xerr != nil {
+			h.sendError(client, env.RequestID, xerr)
+			return
+		}
+		h.handleChatMessage(client, env, &f)
+	case OpTyping:
+		var f TypingFrame
+		if xerr := decodeFrame(client.codec, raw, &f); xerr != nil {
+			h.sendError(client, env.RequestID, xerr)
+			return
+		}
+		h.handleTypingStatus(client, env, &f)
+	case OpReadReceipt:
+		var f ReadReceiptFrame
+		if xerr := decodeFrame(client.codec, raw, &f); xerr != nil {
+			h.sendError(client, env.RequestID, xerr)
+			return
+		}
+		h.handleReadReceipt(client, env, &f)
+	default:
+		h.sendError(client, env.RequestID, xerror.New(xerror.CodeInvalidParams, "unknown frame type").
+			WithDetail("type", env.Type))
 	}
 }
 
@@ -170,52 +251,111 @@ func (h *Hub) PublishToRedis(roomID uint, msgType string, payload []byte) {
 	}
 }
 
-func (h *Hub) handlePing(client *Client) {
-	response, _ := json.Marshal(map[string]interface{}{
-		"type": "pong",
-	})
+const userNotifyPrefix = "user:notify:"
+
+// PublishToUser delivers an event to every connection of userID, on any
+// instance.
+func (h *Hub) PublishToUser(userID uint, payload []byte) {
+	if err := h.rdb.Publish(context.Background(), fmt.Sprintf("%s%d", userNotifyPrefix, userID), payload).Err(); err != nil {
+		logger.L.Error("failed to publish to redis", zap.Error(err), zap.Uint("user_id", userID))
+	}
+}
+
+func (h *Hub) handlePing(client *Client, env Envelope) {
+	h.sendFrame(client, Frame{Type: FramePong, RequestID: env.RequestID})
+}
+
+// sendFrame queues a frame for client. Clients already unregistered are
+// skipped, since their send channel is closed.
+func (h *Hub) sendFrame(client *Client, frame Frame) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.clients[client.UserID][client] {
+		return
+	}
 	select {
-	case client.send <- response:
+	case client.send <- frame:
 	default:
 		// Client buffer full
 	}
 }
 
-func (h *Hub) handleChatMessage(client *Client, msg map[string]interface{}) {
-	roomID := uint(msg["room_id"].(float64))
-	content, _ := msg["content"].(string)
-	mType, _ := msg["message_type"].(string)
+func (h *Hub) sendError(client *Client, requestID string, err error) {
+	var xerr *xerror.Error
+	if !errors.As(err, &xerr) {
+		xerr = xerror.New(xerror.CodeInternalError, err.Error())
+	}
+	h.sendFrame(client, Frame{Type: FrameError, RequestID: requestID, Data: xerr})
+}
+
+func (h *Hub) handleChatMessage(client *Client, env Envelope, f *ChatMessageFrame) {
+	roomID := f.RoomID
+
+	if err := h.authz.RequireMember(client.UserID, roomID, command.OpSendMessage); err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
+	}
+
+	rm, err := h.roomRepo.GetByID(roomID)
+	if err != nil {
+		h.sendError(client, env.RequestID, xerror.New(xerror.CodeNotFound, "room not found"))
+		return
+	}
+	if err := h.roomRepo.LoadMemberships(rm, client.UserID); err != nil {
+		h.sendError(client, env.RequestID, xerror.New(xerror.CodeInternalError, "failed to load room"))
+		return
+	}
+	if err := h.authz.RequireCanSpeak(client.UserID, rm); err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
+	}
+	screened, err := h.moderation.Screen(f.Content)
+	if err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
+	}
 
 	chatMsg := &chat.Message{
 		RoomID:   roomID,
 		SenderID: client.UserID,
-		Content:  content,
-		Type:     chat.MessageType(mType),
+		Content:  screened.Text,
+		Format:   chat.TextFormat(f.Format),
+		Type:     chat.MessageType(f.MessageType),
+		FileURL:  f.FileURL,
+		FileName: f.FileName,
+		FileSize: f.FileSize,
+		Mentions: f.Mentions,
 	}
-
-	if fileUrl, ok := msg["file_url"].(string); ok {
-		chatMsg.FileURL = fileUrl
-	}
-	if fileName, ok := msg["file_name"].(string); ok {
-		chatMsg.FileName = fileName
+	if err := chatMsg.Render(); err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
 	}
-	if fileSize, ok := msg["file_size"].(float64); ok {
-		chatMsg.FileSize = int64(fileSize)
+
+	// Limits run last so rejected frames do not use up the sender's window
+	// or slow-mode cooldown
+	if xerr := h.checkSendLimits(client.UserID, rm); xerr != nil {
+		h.sendError(client, env.RequestID, xerr)
+		return
 	}
 
 	if err := h.messageRepo.Create(chatMsg); err != nil {
 		logger.L.Error("failed to save message", zap.Error(err))
+		h.sendError(client, env.RequestID, xerror.New(xerror.CodeInternalError, "failed to save message"))
 		return
 	}
-
-	// Unhide room for members when a new message is sent
-	rm, err := h.roomRepo.GetByID(roomID)
-	if err == nil {
-		for _, member := range rm.Members {
-			h.roomRepo.SetHidden(roomID, member.ID, false)
-		}
-		
-		// Notify members to ensure room appears in their list
+	h.moderation.Flag(screened, client.UserID, moderation.TargetMessage, chatMsg.ID)
+	h.setTyping(client.UserID, roomID, false)
+
+	// Unhide room for members when a new message is sent, and notify them
+	// to ensure it appears in their list. Large rooms only notify the members
+	// who had hidden it: re-sending the room to everyone on each message does
+	// not scale.
+	unhidden, err := h.roomRepo.UnhideForAll(roomID)
+	if err != nil {
+		logger.L.Error("failed to unhide room", zap.Error(err), zap.Uint("room_id", roomID))
+	}
+	if !rm.Large || len(unhidden) > 0 {
 		resp := rm.ToResponse()
 		notification, _ := json.Marshal(map[string]interface{}{
 			"type": "room_created",
@@ -223,7 +363,13 @@ func (h *Hub) handleChatMessage(client *Client, msg map[string]interface{}) {
 				"room": resp,
 			},
 		})
-		h.PublishToRedis(roomID, "room_created", notification)
+		if !rm.Large {
+			h.PublishToRedis(roomID, "room_created", notification)
+		} else {
+			for _, id := range unhidden {
+				h.PublishToUser(id, notification)
+			}
+		}
 	}
 
 	// Fetch message again to get sender info
@@ -242,34 +388,50 @@ func (h *Hub) handleChatMessage(client *Client, msg map[string]interface{}) {
 
 	// Publish to Redis instead of direct broadcast
 	h.PublishToRedis(roomID, "message", response)
-}
 
-func (h *Hub) handleTypingStatus(client *Client, msg map[string]interface{}) {
-	roomID := uint(msg["room_id"].(float64))
-	// Broadcast typing status to room members via Redis
-	response, _ := json.Marshal(map[string]interface{}{
-		"type":    "typing",
-		"room_id": roomID,
-		"data":    msg["data"],
-		"user_id": client.UserID,
+	h.sendFrame(client, Frame{
+		Type:      FrameAck,
+		RequestID: env.RequestID,
+		Data:      map[string]interface{}{"message_id": chatMsg.ID},
 	})
+}
 
-	// Publish to Redis instead of direct broadcast
-	h.PublishToRedis(roomID, "typing", response)
+func (h *Hub) handleTypingStatus(client *Client, env Envelope, f *TypingFrame) {
+	roomID := f.RoomID
+	if err := h.authz.RequireMember(client.UserID, roomID, command.OpTyping); err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
+	}
+	// Typing indicators are not relayed in large rooms
+	if h.isLarge(roomID) {
+		return
+	}
+	h.setTyping(client.UserID, roomID, f.IsTyping())
 }
 
-func (h *Hub) handleReadReceipt(client *Client, msg map[string]interface{}) {
-	roomID := uint(msg["room_id"].(float64))
-	messageID := uint(msg["message_id"].(float64))
+func (h *Hub) handleReadReceipt(client *Client, env Envelope, f *ReadReceiptFrame) {
+	roomID := f.RoomID
+	messageID := f.MessageID
+	if err := h.authz.RequireMember(client.UserID, roomID, command.OpReadReceipt); err != nil {
+		h.sendError(client, env.RequestID, err)
+		return
+	}
 
 	if err := h.messageRepo.MarkAsRead(roomID, client.UserID, messageID); err != nil {
+		h.sendError(client, env.RequestID, xerror.New(xerror.CodeInternalError, "failed to mark as read"))
 		return
 	}
 
 	h.BroadcastReadReceipt(roomID, messageID, client.UserID)
 }
 
+// BroadcastReadReceipt tells the room's members that userID has read up to
+// lastReadMessageID. Large rooms keep receipts private: relaying each
+// member's to the whole room does not scale.
 func (h *Hub) BroadcastReadReceipt(roomID uint, lastReadMessageID uint, userID uint) {
+	if h.isLarge(roomID) {
+		return
+	}
 	response, _ := json.Marshal(map[string]interface{}{
 		"type": "read_receipt",
 		"data": map[string]interface{}{
@@ -290,7 +452,7 @@ func (h *Hub) SendToUser(userID uint, message []byte) {
 	if clients, ok := h.clients[userID]; ok {
 		for client := range clients {
 			select {
-			case client.send <- message:
+			case client.send <- json.RawMessage(message):
 			default:
 				// Buffer full, skip or close
 			}
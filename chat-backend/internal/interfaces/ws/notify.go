@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"chat-backend/pkg/logger"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// deliverToMembers sends a room event to every member. Members who muted
+// the room's notifications still receive messages, but flagged "silent" so
+// their clients skip sounds and badges; being mentioned overrides the mute.
+func (h *Hub) deliverToMembers(roomID uint, memberIDs []uint, msgType string, payload []byte) {
+	var muted map[uint]bool
+	if msgType == "message" {
+		mutes, err := h.roomRepo.NotifyMutedMembers(roomID)
+		if err != nil {
+			logger.L.Error("failed to load muted members", zap.Error(err), zap.Uint("room_id", roomID))
+		}
+		now := time.Now()
+		for _, m := range mutes {
+			if m.Settings.NotificationsMuted(now) {
+				if muted == nil {
+					muted = make(map[uint]bool)
+				}
+				muted[m.UserID] = true
+			}
+		}
+	}
+
+	var silent []byte
+	var mentioned map[uint]bool
+	for _, id := range memberIDs {
+		out := payload
+		if muted[id] {
+			if silent == nil {
+				silent, mentioned = silenceMessage(payload)
+			}
+			if !mentioned[id] {
+				out = silent
+			}
+		}
+		h.SendToUser(id, out)
+	}
+}
+
+// silenceMessage returns payload with data.silent set, and who the message
+// mentions. Payloads it cannot parse are returned unchanged.
+func silenceMessage(payload []byte) ([]byte, map[uint]bool) {
+	var event struct {
+		Type string                     `json:"type"`
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.Data == nil {
+		return payload, nil
+	}
+
+	var msg struct {
+		Mentions []uint `json:"mentions"`
+	}
+	json.Unmarshal(event.Data["message"], &msg)
+	mentioned := make(map[uint]bool, len(msg.Mentions))
+	for _, id := range msg.Mentions {
+		mentioned[id] = true
+	}
+
+	event.Data["silent"] = json.RawMessage("true")
+	silent, err := json.Marshal(event)
+	if err != nil {
+		return payload, mentioned
+	}
+	return silent, mentioned
+}
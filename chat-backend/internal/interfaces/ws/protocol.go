@@ -0,0 +1,129 @@
+package ws
+
+import (
+	"chat-backend/internal/domain/chat"
+	"chat-backend/pkg/xerror"
+	"strconv"
+)
+
+// Protocol versions understood by this server. Clients pick one with the
+// "v" query parameter when connecting, or through the negotiated
+// subprotocol (see Codec); omitting both selects version 1, which is what
+// the web frontend speaks.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Client -> server operations
+const (
+	OpPing        = "ping"
+	OpMessage     = "message"
+	OpTyping      = "typing"
+	OpReadReceipt = "read_receipt"
+)
+
+// Server -> client frame types that are not room events
+const (
+	FrameWelcome = "welcome"
+	FramePong    = "pong"
+	FrameAck     = "ack"
+	FrameError   = "error"
+	// FrameBatch carries several frames in "data" for clients that opted
+	// into batching with batch=1 at connect time
+	FrameBatch = "batch"
+)
+
+// NegotiateVersion resolves the version requested at connect time.
+func NegotiateVersion(requested string) (int, *xerror.Error) {
+	if requested == "" {
+		return ProtocolVersion, nil
+	}
+	v, err := strconv.Atoi(requested)
+	if err != nil || v < MinProtocolVersion || v > ProtocolVersion {
+		return 0, xerror.New(xerror.CodeInvalidParams, "unsupported protocol version").
+			WithDetail("min_version", MinProtocolVersion).
+			WithDetail("max_version", ProtocolVersion)
+	}
+	return v, nil
+}
+
+// Envelope is the header shared by every client frame. The op specific
+// fields are decoded separately once the type is known.
+type Envelope struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Frame is a server frame answering a client request.
+type Frame struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+type ChatMessageFrame struct {
+	RoomID      uint   `json:"room_id"`
+	Content     string `json:"content"`
+	MessageType string `json:"message_type"`
+	Format      string `json:"format"`
+	FileURL     string `json:"file_url"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	Mentions    []uint `json:"mentions"`
+}
+
+func (f *ChatMessageFrame) Validate() *xerror.Error {
+	if f.RoomID == 0 {
+		return xerror.New(xerror.CodeInvalidParams, "room_id is required")
+	}
+	if f.Content == "" && f.FileURL == "" {
+		return xerror.New(xerror.CodeInvalidParams, "content or file_url is required")
+	}
+	if chat.MessageType(f.MessageType) == chat.MessageTypeSystem {
+		return xerror.New(xerror.CodeInvalidParams, "system messages cannot be sent by clients")
+	}
+	return nil
+}
+
+type TypingFrame struct {
+	RoomID uint                   `json:"room_id"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+func (f *TypingFrame) Validate() *xerror.Error {
+	if f.RoomID == 0 {
+		return xerror.New(xerror.CodeInvalidParams, "room_id is required")
+	}
+	return nil
+}
+
+// IsTyping reads data.is_typing; frames without it count as typing.
+func (f *TypingFrame) IsTyping() bool {
+	v, ok := f.Data["is_typing"].(bool)
+	return !ok || v
+}
+
+type ReadReceiptFrame struct {
+	RoomID    uint `json:"room_id"`
+	MessageID uint `json:"message_id"`
+}
+
+func (f *ReadReceiptFrame) Validate() *xerror.Error {
+	if f.RoomID == 0 || f.MessageID == 0 {
+		return xerror.New(xerror.CodeInvalidParams, "room_id and message_id are required")
+	}
+	return nil
+}
+
+type validator interface {
+	Validate() *xerror.Error
+}
+
+// decodeFrame unmarshals raw into an op payload and validates it.
+func decodeFrame(c Codec, raw []byte, v validator) *xerror.Error {
+	if err := c.Unmarshal(raw, v); err != nil {
+		return xerror.New(xerror.CodeInvalidParams, "malformed frame: "+err.Error())
+	}
+	return v.Validate()
+}
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"chat-backend/internal/domain/room"
+	"chat-backend/pkg/logger"
+	"chat-backend/pkg/ratelimit"
+	"chat-backend/pkg/xerror"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type rateLimitConfig struct {
+	UserLimit  int
+	UserWindow time.Duration
+	RoomLimit  int
+	RoomWindow time.Duration
+}
+
+func loadRateLimitConfig() rateLimitConfig {
+	cfg := rateLimitConfig{
+		UserLimit:  viper.GetInt("ratelimit.user.limit"),
+		UserWindow: viper.GetDuration("ratelimit.user.window"),
+		RoomLimit:  viper.GetInt("ratelimit.room.limit"),
+		RoomWindow: viper.GetDuration("ratelimit.room.window"),
+	}
+
+	// Set default values if not configured
+	if cfg.UserLimit == 0 {
+		cfg.UserLimit = 20
+	}
+	if cfg.UserWindow == 0 {
+		cfg.UserWindow = 10 * time.Second
+	}
+	if cfg.RoomLimit == 0 {
+		cfg.RoomLimit = 100
+	}
+	if cfg.RoomWindow == 0 {
+		cfg.RoomWindow = 10 * time.Second
+	}
+	return cfg
+}
+
+// checkSendLimits enforces the per-user and per-room sliding windows and the
+// room's slow mode once a message has passed every other check, just before
+// it is persisted. All of them are checked and recorded in one step, so a
+// send refused by one limit does not count against the others. Limits live
+// in Redis so they hold across instances; if Redis is unavailable sends are
+// let through.
+func (h *Hub) checkSendLimits(userID uint, rm *room.Room) *xerror.Error {
+	windows := []ratelimit.Window{
+		{Key: fmt.Sprintf("ratelimit:user:%d", userID), Limit: h.rateLimits.UserLimit, Window: h.rateLimits.UserWindow},
+		{Key: fmt.Sprintf("ratelimit:room:%d", rm.ID), Limit: h.rateLimits.RoomLimit, Window: h.rateLimits.RoomWindow},
+	}
+	slowMode := rm.Type.IsGroup() && rm.SlowMode > 0 && !rm.RoleOf(userID).Can(room.PermModerate)
+	if slowMode {
+		// One message per interval
+		windows = append(windows, ratelimit.Window{
+			Key:    fmt.Sprintf("ratelimit:slowmode:%d:%d", rm.ID, userID),
+			Limit:  1,
+			Window: time.Duration(rm.SlowMode) * time.Second,
+		})
+	}
+
+	ok, denied, retryAfter, err := h.limiter.AllowAll(context.Background(), windows...)
+	if err != nil {
+		logger.L.Error("rate limit check failed", zap.Error(err), zap.Uint("user_id", userID), zap.Uint("room_id", rm.ID))
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	switch denied {
+	case 0:
+		return xerror.New(xerror.CodeRateLimited, "you are sending messages too fast").
+			WithDetail("retry_after_ms", retryAfter.Milliseconds())
+	case 1:
+		return xerror.New(xerror.CodeRateLimited, "this room is receiving too many messages").
+			WithDetail("retry_after_ms", retryAfter.Milliseconds())
+	default:
+		return xerror.New(xerror.CodeRateLimited, "slow mode is enabled in this room").
+			WithDetail("retry_after_ms", retryAfter.Milliseconds()).
+			WithDetail("slow_mode", rm.SlowMode)
+	}
+}
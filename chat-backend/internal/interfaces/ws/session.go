@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// Long-poll sessions not polled for this long are unregistered
+	sessionIdleTimeout = 60 * time.Second
+	sessionSweepPeriod = 15 * time.Second
+	// Opening more sessions than this closes the user's least recently used
+	// one, so clients that poll without a session cannot pile them up
+	maxSessionsPerUser = 8
+)
+
+// Session is a virtual client for transports without a socket: Server-Sent
+// Events and long polling. It registers with the hub like a WebSocket
+// client, so fan-out and presence behave the same, and receives client frames
+// submitted over REST.
+type Session struct {
+	ID     string
+	client *Client
+
+	mu        sync.Mutex
+	lastSeen  time.Time
+	streaming int // attached SSE streams; streamed sessions never idle out
+}
+
+// sessionRegistry tracks the sessions opened on this instance.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// OpenSession registers a virtual client for userID.
+func (h *Hub) OpenSession(userID uint, version int) *Session {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	s := &Session{
+		ID:       hex.EncodeToString(id),
+		lastSeen: time.Now(),
+	}
+	s.client = &Client{
+		Hub:        h,
+		UserID:     userID,
+		Version:    version,
+		codec:      jsonCodec{},
+		sessionID:  s.ID,
+		send:       make(chan interface{}, 256),
+		registered: make(chan struct{}),
+	}
+
+	h.sessions.mu.Lock()
+	evicted := h.sessions.evictFor(userID)
+	h.sessions.sessions[s.ID] = s
+	h.sessions.mu.Unlock()
+
+	if evicted != nil {
+		h.CloseSession(evicted)
+	}
+	h.Register <- s.client
+	return s
+}
+
+// evictFor returns the session to close before userID opens another, or nil
+// while the user is under maxSessionsPerUser. Idle sessions go before
+// streamed ones. Callers hold r.mu.
+func (r *sessionRegistry) evictFor(userID uint) *Session {
+	var (
+		victim *Session
+		count  int
+	)
+	for _, s := range r.sessions {
+		if s.client.UserID != userID {
+			continue
+		}
+		count++
+		if victim == nil || s.evictsBefore(victim) {
+			victim = s
+		}
+	}
+	if count < maxSessionsPerUser {
+		return nil
+	}
+	return victim
+}
+
+// Session looks up a session owned by userID.
+func (h *Hub) Session(id string, userID uint) (*Session, bool) {
+	h.sessions.mu.Lock()
+	defer h.sessions.mu.Unlock()
+	s, ok := h.sessions.sessions[id]
+	if !ok || s.client.UserID != userID {
+		return nil, false
+	}
+	return s, true
+}
+
+// CloseSession unregisters the session's virtual client.
+func (h *Hub) CloseSession(s *Session) {
+	h.sessions.mu.Lock()
+	_, ok := h.sessions.sessions[s.ID]
+	delete(h.sessions.sessions, s.ID)
+	h.sessions.mu.Unlock()
+
+	if ok {
+		h.Unregister <- s.client
+	}
+}
+
+// Submit handles a client frame as if it had been read from a socket, on the
+// caller's goroutine. Replies (ack, error, pong) are delivered on the
+// session's stream.
+func (h *Hub) Submit(s *Session, raw []byte) {
+	s.touch()
+	<-s.client.registered
+	h.handleIncomingMessage(s.client, raw)
+}
+
+func (h *Hub) sweepSessions() {
+	ticker := time.NewTicker(sessionSweepPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []*Session
+		h.sessions.mu.Lock()
+		for _, s := range h.sessions.sessions {
+			if s.idle() {
+				expired = append(expired, s)
+			}
+		}
+		h.sessions.mu.Unlock()
+
+		for _, s := range expired {
+			h.CloseSession(s)
+		}
+	}
+}
+
+// Attach marks an SSE stream as reading the session and returns its events.
+// The channel is closed when the session is closed. Call the returned func
+// when the stream ends.
+func (s *Session) Attach() (<-chan interface{}, func()) {
+	s.mu.Lock()
+	s.streaming++
+	s.mu.Unlock()
+	return s.client.send, func() {
+		s.mu.Lock()
+		s.streaming--
+		s.lastSeen = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// Poll waits up to wait for at least one event and returns everything queued
+// at that point. closed reports that the session is gone.
+func (s *Session) Poll(ctx context.Context, wait time.Duration) (events []json.RawMessage, closed bool) {
+	s.touch()
+	defer s.touch()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case item, ok := <-s.client.send:
+		if !ok {
+			return nil, true
+		}
+		events = s.appendEvent(events, item)
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	for len(events) < maxBatchSize {
+		select {
+		case item, ok := <-s.client.send:
+			if !ok {
+				return events, true
+			}
+			events = s.appendEvent(events, item)
+		default:
+			return events, false
+		}
+	}
+	return events, false
+}
+
+// Encode renders a queued event as JSON.
+func (s *Session) Encode(item interface{}) ([]byte, error) {
+	return s.client.codec.Marshal(item)
+}
+
+func (s *Session) appendEvent(events []json.RawMessage, item interface{}) []json.RawMessage {
+	data, err := s.Encode(item)
+	if err != nil {
+		return events
+	}
+	return append(events, data)
+}
+
+func (s *Session) touch() {
+	s.mu.Lock()
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+}
+
+// evictsBefore orders sessions for eviction: not streaming first, then least
+// recently seen.
+func (s *Session) evictsBefore(other *Session) bool {
+	s.mu.Lock()
+	streaming, lastSeen := s.streaming > 0, s.lastSeen
+	s.mu.Unlock()
+	other.mu.Lock()
+	otherStreaming, otherLastSeen := other.streaming > 0, other.lastSeen
+	other.mu.Unlock()
+
+	if streaming != otherStreaming {
+		return !streaming
+	}
+	return lastSeen.Before(otherLastSeen)
+}
+
+func (s *Session) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streaming == 0 && time.Since(s.lastSeen) > sessionIdleTimeout
+}
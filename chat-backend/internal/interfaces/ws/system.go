@@ -0,0 +1,20 @@
+package ws
+
+import (
+	"chat-backend/internal/domain/chat"
+	"encoding/json"
+)
+
+// PublishMessages fans out messages stored outside the hub, such as the
+// system messages recorded by room commands, like any chat message.
+func (h *Hub) PublishMessages(msgs []chat.Message) {
+	for _, msg := range msgs {
+		response, _ := json.Marshal(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{
+				"message": msg.ToResponse(),
+			},
+		})
+		h.PublishToRedis(msg.RoomID, "message", response)
+	}
+}
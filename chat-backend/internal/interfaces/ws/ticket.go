@@ -0,0 +1,45 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	streamTicketKeyFmt = "streamticket:%s"
+	// StreamTicketTTL bounds how long an issued ticket may wait to be used
+	StreamTicketTTL = 30 * time.Second
+)
+
+// IssueStreamTicket returns a single-use ticket authenticating userID on the
+// event-stream routes. Browsers' EventSource cannot set an Authorization
+// header, and a ticket keeps the long-lived JWT out of URLs and access logs.
+func (h *Hub) IssueStreamTicket(userID uint) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(id)
+	key := fmt.Sprintf(streamTicketKeyFmt, ticket)
+	if err := h.rdb.Set(context.Background(), key, userID, StreamTicketTTL).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// RedeemStreamTicket consumes ticket and returns the user it was issued to.
+// A ticket is valid once; expired, reused or unknown tickets report false.
+func (h *Hub) RedeemStreamTicket(ticket string) (uint, bool) {
+	if ticket == "" {
+		return 0, false
+	}
+	key := fmt.Sprintf(streamTicketKeyFmt, ticket)
+	userID, err := h.rdb.GetDel(context.Background(), key).Uint64()
+	if err != nil || userID == 0 {
+		return 0, false
+	}
+	return uint(userID), true
+}
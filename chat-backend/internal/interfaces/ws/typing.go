@@ -0,0 +1,251 @@
+package ws
+
+import (
+	"chat-backend/pkg/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Typing indicators are aggregated per room instead of relaying every
+// keystroke frame. Who is typing lives in a Redis sorted set scored by
+// expiry, so every instance sees the same state; each instance publishes a
+// typing_state event for the rooms it wrote to, at most once per interval
+// and only when the set changed.
+const (
+	typingKeyFmt = "typing:room:%d"
+	// Names listed in typing_state before falling back to "and N others"
+	maxTypingNames = 3
+)
+
+type typingConfig struct {
+	TTL      time.Duration // a typist disappears this long after its last frame
+	Throttle time.Duration // repeated is_typing frames within this are dropped
+	Interval time.Duration // minimum gap between typing_state events per room
+}
+
+func loadTypingConfig() typingConfig {
+	cfg := typingConfig{
+		TTL:      viper.GetDuration("ws.typing.ttl"),
+		Throttle: viper.GetDuration("ws.typing.throttle"),
+		Interval: viper.GetDuration("ws.typing.interval"),
+	}
+
+	// Set default values if not configured
+	if cfg.TTL == 0 {
+		cfg.TTL = 6 * time.Second
+	}
+	if cfg.Throttle == 0 {
+		cfg.Throttle = 2 * time.Second
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Second
+	}
+	return cfg
+}
+
+type typingKey struct {
+	userID uint
+	roomID uint
+}
+
+// typingTracker holds the per-instance bookkeeping; the typing state itself
+// is in Redis.
+type typingTracker struct {
+	cfg typingConfig
+
+	mu sync.Mutex
+	// last accepted is_typing frame per user and room
+	last map[typingKey]time.Time
+	// rooms whose set changed since their last typing_state
+	dirty map[uint]bool
+	// rooms this instance wrote to, watched until their set is empty
+	active map[uint]bool
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{
+		cfg:    loadTypingConfig(),
+		last:   make(map[typingKey]time.Time),
+		dirty:  make(map[uint]bool),
+		active: make(map[uint]bool),
+	}
+}
+
+// accept applies the per-user throttle to an is_typing frame.
+func (t *typingTracker) accept(userID, roomID uint, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{userID, roomID}
+	if now.Sub(t.last[key]) < t.cfg.Throttle {
+		return false
+	}
+	t.last[key] = now
+	return true
+}
+
+func (t *typingTracker) forget(userID, roomID uint) {
+	t.mu.Lock()
+	delete(t.last, typingKey{userID, roomID})
+	t.mu.Unlock()
+}
+
+func (t *typingTracker) touch(roomID uint, changed bool) {
+	t.mu.Lock()
+	t.active[roomID] = true
+	if changed {
+		t.dirty[roomID] = true
+	}
+	t.mu.Unlock()
+}
+
+// setTyping records a typing frame. Only frames that change the state are
+// written through; keep-alive frames just extend the expiry.
+func (h *Hub) setTyping(userID, roomID uint, isTyping bool) {
+	ctx := context.Background()
+	key := fmt.Sprintf(typingKeyFmt, roomID)
+	now := time.Now()
+
+	if !isTyping {
+		h.typing.forget(userID, roomID)
+		removed, err := h.rdb.ZRem(ctx, key, userID).Result()
+		if err != nil {
+			logger.L.Error("failed to clear typing state", zap.Error(err), zap.Uint("room_id", roomID))
+			return
+		}
+		if removed > 0 {
+			h.typing.touch(roomID, true)
+		}
+		return
+	}
+
+	if !h.typing.accept(userID, roomID, now) {
+		return
+	}
+
+	var added *redis.IntCmd
+	_, err := h.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		added = pipe.ZAdd(ctx, key, redis.Z{
+			Score:  float64(now.Add(h.typing.cfg.TTL).UnixMilli()),
+			Member: userID,
+		})
+		pipe.Expire(ctx, key, 2*h.typing.cfg.TTL)
+		return nil
+	})
+	if err != nil {
+		logger.L.Error("failed to save typing state", zap.Error(err), zap.Uint("room_id", roomID))
+		return
+	}
+	h.typing.touch(roomID, added.Val() > 0)
+}
+
+// runTypingPublisher emits typing_state for rooms whose set changed or had
+// entries expire.
+func (h *Hub) runTypingPublisher() {
+	ticker := time.NewTicker(h.typing.cfg.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.typing.mu.Lock()
+		rooms := make(map[uint]bool, len(h.typing.active))
+		for roomID := range h.typing.active {
+			rooms[roomID] = h.typing.dirty[roomID]
+		}
+		h.typing.dirty = make(map[uint]bool)
+		for key, at := range h.typing.last {
+			if now.Sub(at) > h.typing.cfg.TTL {
+				delete(h.typing.last, key)
+			}
+		}
+		h.typing.mu.Unlock()
+
+		for roomID, dirty := range rooms {
+			h.publishTypingState(roomID, dirty, now)
+		}
+	}
+}
+
+func (h *Hub) publishTypingState(roomID uint, dirty bool, now time.Time) {
+	ctx := context.Background()
+	key := fmt.Sprintf(typingKeyFmt, roomID)
+
+	// Whichever instance removes an expired typist reports the change
+	expired, err := h.rdb.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10)).Result()
+	if err != nil {
+		logger.L.Error("failed to expire typing state", zap.Error(err), zap.Uint("room_id", roomID))
+		return
+	}
+	members, err := h.rdb.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.L.Error("failed to load typing state", zap.Error(err), zap.Uint("room_id", roomID))
+		return
+	}
+
+	if len(members) == 0 {
+		h.typing.mu.Lock()
+		if !h.typing.dirty[roomID] {
+			delete(h.typing.active, roomID)
+		}
+		h.typing.mu.Unlock()
+	}
+	if !dirty && expired == 0 {
+		return
+	}
+
+	userIDs := make([]uint, 0, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseUint(m, 10, 32); err == nil {
+			userIDs = append(userIDs, uint(id))
+		}
+	}
+
+	users := make([]map[string]interface{}, 0, maxTypingNames)
+	names := make([]string, 0, maxTypingNames)
+	for _, id := range userIDs {
+		if len(users) == maxTypingNames {
+			break
+		}
+		name := strconv.FormatUint(uint64(id), 10)
+		if u, err := h.userRepo.GetByID(id); err == nil {
+			name = u.DisplayName()
+		}
+		users = append(users, map[string]interface{}{"id": id, "nickname": name})
+		names = append(names, name)
+	}
+
+	response, _ := json.Marshal(map[string]interface{}{
+		"type": "typing_state",
+		"data": map[string]interface{}{
+			"room_id":  roomID,
+			"user_ids": userIDs,
+			"users":    users,
+			"count":    len(userIDs),
+			"text":     typingText(names, len(userIDs)),
+		},
+	})
+	h.PublishToRedis(roomID, "typing_state", response)
+}
+
+// typingText renders "alice is typing", "alice, bob are typing" or
+// "alice, bob, carol and 2 others are typing".
+func typingText(names []string, total int) string {
+	switch {
+	case total == 0:
+		return ""
+	case total == 1:
+		return names[0] + " is typing"
+	case total > len(names):
+		return fmt.Sprintf("%s and %d others are typing", strings.Join(names, ", "), total-len(names))
+	default:
+		return strings.Join(names, ", ") + " are typing"
+	}
+}
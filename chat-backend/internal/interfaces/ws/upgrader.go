@@ -4,14 +4,35 @@ import (
 	"net/http"
 
 	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 )
 
+// Frames smaller than this are sent uncompressed; deflate costs more CPU
+// than it saves on tiny typing and read_receipt events.
+const defaultCompressionThreshold = 512
+
 func GetUpgrader() *websocket.Upgrader {
 	return &websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		Subprotocols:      Subprotocols(),
+		EnableCompression: compressionEnabled(),
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all for development
 		},
 	}
 }
+
+func compressionEnabled() bool {
+	if !viper.IsSet("ws.compression") {
+		return true
+	}
+	return viper.GetBool("ws.compression")
+}
+
+func compressionThreshold() int {
+	if !viper.IsSet("ws.compression_threshold") {
+		return defaultCompressionThreshold
+	}
+	return viper.GetInt("ws.compression_threshold")
+}
@@ -0,0 +1,274 @@
+// Package markdown validates the Markdown subset accepted in chat messages
+// and renders it to plain text.
+//
+// Supported: **bold**, __bold__, *italic*, _italic_, `code`, fenced code
+// blocks, [links](https://...), <https://autolinks>, ordered and unordered
+// lists and @mentions. Raw HTML tags are rejected everywhere, code included;
+// images and links with schemes other than http, https and mailto are
+// rejected outside code. Plain-text messages go through CheckHTML.
+//
+// Rejecting tags is not full sanitization: "<", ">" and "&" may still appear
+// as text ("a < b"), so clients must escape bodies before rendering them.
+package markdown
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrHTML        = errors.New("raw HTML is not allowed")
+	ErrImage       = errors.New("images are not supported")
+	ErrUnsafeLink  = errors.New("only http, https and mailto links are allowed")
+	ErrControlChar = errors.New("control characters are not allowed")
+)
+
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// CheckHTML rejects text containing a raw HTML tag, comment or processing
+// instruction. Comparisons ("a < b") and autolinks ("<https://...>") pass.
+func CheckHTML(src string) error {
+	for i := strings.IndexByte(src, '<'); i >= 0; {
+		if isTagStart(src, i) {
+			return ErrHTML
+		}
+		next := strings.IndexByte(src[i+1:], '<')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+// isTagStart reports whether the '<' at s[i] opens a tag rather than an
+// autolink or a comparison.
+func isTagStart(s string, i int) bool {
+	if end := strings.IndexByte(s[i+1:], '>'); end > 0 {
+		if u := s[i+1 : i+1+end]; strings.Contains(u, ":") && !strings.ContainsAny(u, " \t") {
+			return false
+		}
+	}
+	return i+1 < len(s) && (isLetter(s[i+1]) || strings.IndexByte("/!?", s[i+1]) >= 0)
+}
+
+// PlainText validates src and returns its plain-text rendering, used for
+// search, notifications and conversation previews. The result is text, not
+// HTML.
+func PlainText(src string) (string, error) {
+	for _, r := range src {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' {
+			return "", ErrControlChar
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			// Code is text, but a tag in it is still a tag to a careless client
+			if err := CheckHTML(line); err != nil {
+				return "", err
+			}
+			out = append(out, line)
+			continue
+		}
+
+		marker, rest := splitListMarker(line)
+		text, err := inline(rest)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, marker+text)
+	}
+
+	return strings.TrimSpace(strings.Join(out, "\n")), nil
+}
+
+// splitListMarker separates a leading "- ", "* ", "+ " or "1. " list marker.
+// Unordered markers are normalized to "- " in the plain rendering.
+func splitListMarker(line string) (string, string) {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	body := line[indent:]
+	if len(body) >= 2 && strings.ContainsRune("-*+", rune(body[0])) && body[1] == ' ' {
+		return line[:indent] + "- ", strings.TrimLeft(body[2:], " ")
+	}
+	i := 0
+	for i < len(body) && i < 9 && body[i] >= '0' && body[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(body) && (body[i] == '.' || body[i] == ')') && body[i+1] == ' ' {
+		return line[:indent] + body[:i+1] + " ", strings.TrimLeft(body[i+2:], " ")
+	}
+	return "", line
+}
+
+// inline renders the inline constructs of a single line.
+func inline(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteByte(s[i+1])
+			i += 2
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				if err := CheckHTML(s[i+1 : i+1+end]); err != nil {
+					return "", err
+				}
+				b.WriteString(s[i+1 : i+1+end])
+				i += end + 2
+				continue
+			}
+			b.WriteByte(c)
+			i++
+
+		case c == '<':
+			if end := strings.IndexByte(s[i+1:], '>'); end > 0 {
+				if u := s[i+1 : i+1+end]; strings.Contains(u, ":") && !strings.ContainsAny(u, " \t") {
+					if !safeURL(u) {
+						return "", ErrUnsafeLink
+					}
+					b.WriteString(u)
+					i += end + 2
+					continue
+				}
+			}
+			if isTagStart(s, i) {
+				return "", ErrHTML
+			}
+			b.WriteByte(c)
+			i++
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if _, _, n := parseLink(s[i+1:]); n > 0 {
+				return "", ErrImage
+			}
+			b.WriteByte(c)
+			i++
+
+		case c == '[':
+			text, href, n := parseLink(s[i:])
+			if n == 0 {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			if !safeURL(href) {
+				return "", ErrUnsafeLink
+			}
+			rendered, err := inline(text)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(rendered)
+			i += n
+
+		case c == '*' || c == '_':
+			delim := string(c)
+			if i+1 < len(s) && s[i+1] == c {
+				delim += delim
+			}
+			// Intraword delimiters (snake_case, 3*4) are literal
+			if i > 0 && isWordChar(s[i-1]) {
+				b.WriteString(delim)
+				i += len(delim)
+				continue
+			}
+			inner, n := emphasis(s[i:], delim)
+			if n == 0 {
+				b.WriteString(delim)
+				i += len(delim)
+				continue
+			}
+			rendered, err := inline(inner)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(rendered)
+			i += n
+
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// emphasis matches delim...delim at the start of s and returns the inner
+// text and the number of bytes consumed, or 0 if there is no closing delim.
+func emphasis(s, delim string) (string, int) {
+	rest := s[len(delim):]
+	if rest == "" || rest[0] == ' ' {
+		return "", 0
+	}
+	end := strings.Index(rest, delim)
+	if end <= 0 || rest[end-1] == ' ' {
+		return "", 0
+	}
+	return rest[:end], len(delim)*2 + end
+}
+
+// parseLink matches [text](href) at the start of s.
+func parseLink(s string) (string, string, int) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0
+	}
+	end := strings.IndexByte(s[closeText+2:], ')')
+	if end < 0 {
+		return "", "", 0
+	}
+	href := strings.TrimSpace(s[closeText+2 : closeText+2+end])
+	return s[1:closeText], href, closeText + 3 + end
+}
+
+func safeURL(raw string) bool {
+	if strings.ContainsAny(raw, " \t\n\"'<>") {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return allowedSchemes[strings.ToLower(u.Scheme)]
+}
+
+func isPunct(c byte) bool {
+	return c < 128 && unicode.IsPunct(rune(c)) || strings.IndexByte("`*_<>[]()#+-.!|~", c) >= 0
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordChar(c byte) bool {
+	return isLetter(c) || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -0,0 +1,120 @@
+package markdown
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"bold", "**bold** and __bold__", "bold and bold"},
+		{"italic", "*italic* and _italic_", "italic and italic"},
+		{"nested emphasis", "**bold _italic_**", "bold italic"},
+		{"intraword underscore", "snake_case_name and 3*4*5", "snake_case_name and 3*4*5"},
+		{"unclosed emphasis", "a * b and **c", "a * b and **c"},
+		{"code span", "run `go test ./...` now", "run go test ./... now"},
+		{"code span keeps markup", "`**not bold**`", "**not bold**"},
+		{"link", "see [the docs](https://example.com/docs)", "see the docs"},
+		{"link with emphasis", "[**bold** link](https://example.com)", "bold link"},
+		{"mailto link", "[mail me](mailto:a@example.com)", "mail me"},
+		{"autolink", "<https://example.com>", "https://example.com"},
+		{"escaped punctuation", `\*not italic\*`, "*not italic*"},
+		{"comparison", "a < b and c > d", "a < b and c > d"},
+		{"unordered list", "* one\n+ two\n- three", "- one\n- two\n- three"},
+		{"ordered list", "1. one\n2) two", "1. one\n2) two"},
+		{"mention", "hi @alice", "hi @alice"},
+		{"crlf", "one\r\ntwo", "one\ntwo"},
+		{"surrounding blank lines", "\n\nhello\n\n", "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlainText(tt.src)
+			if err != nil {
+				t.Fatalf("PlainText(%q) error: %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainTextRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want error
+	}{
+		{"tag", "<b>bold</b>", ErrHTML},
+		{"script", "hi <script>alert(1)</script>", ErrHTML},
+		{"closing tag", "</div>", ErrHTML},
+		{"comment", "<!-- hidden -->", ErrHTML},
+		{"image", "![alt](https://example.com/a.png)", ErrImage},
+		{"javascript link", "[x](javascript:alert(1))", ErrUnsafeLink},
+		{"data link", "[x](data:text/html,hi)", ErrUnsafeLink},
+		{"relative link", "[x](/path)", ErrUnsafeLink},
+		{"javascript autolink", "<javascript:alert(1)>", ErrUnsafeLink},
+		{"link in link text", "[[y](javascript:x)](https://example.com)", ErrUnsafeLink},
+		{"control character", "bell\a", ErrControlChar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PlainText(tt.src); !errors.Is(err, tt.want) {
+				t.Errorf("PlainText(%q) error = %v, want %v", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+// Code is passed through verbatim, except that tags are refused there too.
+func TestPlainTextCode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"fenced block", "```go\nif a < b && c > d {}\n```", "if a < b && c > d {}"},
+		{"fenced link stays literal", "```\n[y](javascript:z)\n```", "[y](javascript:z)"},
+		{"code span", "`x < y && y > 1`", "x < y && y > 1"},
+		{"code span autolink", "`<https://example.com>`", "<https://example.com>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlainText(tt.src)
+			if err != nil {
+				t.Fatalf("PlainText(%q) error: %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+
+	for _, src := range []string{
+		"```html\n<b>x</b>\n```",
+		"`<script>alert(1)</script>`",
+		"  ```\n  <!-- c -->\n  ```",
+	} {
+		if _, err := PlainText(src); !errors.Is(err, ErrHTML) {
+			t.Errorf("PlainText(%q) error = %v, want %v", src, err, ErrHTML)
+		}
+	}
+}
+
+func TestCheckHTML(t *testing.T) {
+	for _, src := range []string{"hello", "a < b > c", "1<2", "<https://example.com>", "x <- y", "<3", ""} {
+		if err := CheckHTML(src); err != nil {
+			t.Errorf("CheckHTML(%q) = %v, want nil", src, err)
+		}
+	}
+	for _, src := range []string{"<script>alert(1)</script>", "hi <b>", "</div>", "<!-- x -->", "<?php", "a < b <img src=x>"} {
+		if err := CheckHTML(src); !errors.Is(err, ErrHTML) {
+			t.Errorf("CheckHTML(%q) = %v, want %v", src, err, ErrHTML)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package ratelimit provides Redis-backed limits shared by every server
+// instance.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindows keeps one sorted-set entry per accepted event in each
+// window, scored by its timestamp in milliseconds. KEYS are the windows and
+// ARGV[1] the time, ARGV[2] the member, then a window length and limit per
+// key. Every window is checked before any is recorded, so an event denied by
+// one window does not use up the others. It returns {allowed, denying key
+// index, retry_after_ms}.
+var slidingWindows = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[1 + 2 * i])
+	local limit = tonumber(ARGV[2 + 2 * i])
+	redis.call("ZREMRANGEBYSCORE", key, 0, now - window)
+	if redis.call("ZCARD", key) >= limit then
+		local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+		return {0, i, tonumber(oldest[2]) + window - now}
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call("ZADD", key, now, member)
+	redis.call("PEXPIRE", key, tonumber(ARGV[1 + 2 * i]))
+end
+return {1, 0, 0}
+`)
+
+// Window allows Limit events under Key in any trailing Window. A limit or
+// window of zero disables it.
+type Window struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+type Limiter struct {
+	rdb *redis.Client
+	seq atomic.Uint64
+}
+
+func New(rdb *redis.Client) *Limiter {
+	return &Limiter{rdb: rdb}
+}
+
+// Allow records an event under key if fewer than limit events happened in the
+// trailing window. When denied it returns how long until the next slot frees.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	ok, _, retryAfter, err := l.AllowAll(ctx, Window{Key: key, Limit: limit, Window: window})
+	return ok, retryAfter, err
+}
+
+// AllowAll records an event in every window if each has room for it, in one
+// atomic step: when any window is full nothing is recorded. When denied it
+// returns the index of a full window and how long until it frees a slot.
+func (l *Limiter) AllowAll(ctx context.Context, windows ...Window) (bool, int, time.Duration, error) {
+	var keys []string
+	var index []int // position in windows of each key
+	now := time.Now().UnixMilli()
+	// Members must be unique even for events in the same millisecond
+	args := []interface{}{now, fmt.Sprintf("%d-%d", now, l.seq.Add(1))}
+	for i, w := range windows {
+		if w.Limit <= 0 || w.Window <= 0 {
+			continue
+		}
+		keys = append(keys, w.Key)
+		index = append(index, i)
+		args = append(args, w.Window.Milliseconds(), w.Limit)
+	}
+	if len(keys) == 0 {
+		return true, 0, 0, nil
+	}
+	res, err := slidingWindows.Run(ctx, l.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return true, 0, 0, err
+	}
+	if res[0] == 1 {
+		return true, 0, 0, nil
+	}
+	return false, index[res[1]-1], time.Duration(res[2]) * time.Millisecond, nil
+}
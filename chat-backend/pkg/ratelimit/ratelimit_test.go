@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLimiter connects to REDIS_ADDR (default localhost:6379) and skips
+// the test when no server answers. The returned key and its ":2" and ":3"
+// variants are dropped when the test ends.
+func newTestLimiter(t *testing.T) (*Limiter, string) {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DialTimeout: 200 * time.Millisecond, MaxRetries: -1})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis unavailable at %s: %v", addr, err)
+	}
+
+	key := fmt.Sprintf("test:ratelimit:%s:%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		rdb.Del(context.Background(), key, key+":2", key+":3")
+		rdb.Close()
+	})
+	return New(rdb), key
+}
+
+func TestAllowSlidingWindow(t *testing.T) {
+	l, key := newTestLimiter(t)
+	ctx := context.Background()
+	window := 300 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Allow(ctx, key, 3, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("event %d denied under the limit", i+1)
+		}
+	}
+
+	ok, retryAfter, err := l.Allow(ctx, key, 3, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("event over the limit allowed")
+	}
+	if retryAfter <= 0 || retryAfter > window {
+		t.Errorf("retryAfter = %v, want within (0, %v]", retryAfter, window)
+	}
+
+	time.Sleep(retryAfter + 20*time.Millisecond)
+	if ok, _, err := l.Allow(ctx, key, 3, window); err != nil || !ok {
+		t.Errorf("event after the window slid: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestAllowDeniedEventsAreNotRecorded(t *testing.T) {
+	l, key := newTestLimiter(t)
+	ctx := context.Background()
+	window := 200 * time.Millisecond
+
+	if ok, _, _ := l.Allow(ctx, key, 1, window); !ok {
+		t.Fatal("first event denied")
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _, _ := l.Allow(ctx, key, 1, window); ok {
+			t.Fatal("event over the limit allowed")
+		}
+	}
+	if n := l.rdb.ZCard(ctx, key).Val(); n != 1 {
+		t.Errorf("window holds %d entries, want 1", n)
+	}
+}
+
+func TestAllowDisabled(t *testing.T) {
+	// No Redis round trip is made for disabled limits
+	l := New(nil)
+	for _, c := range []struct {
+		limit  int
+		window time.Duration
+	}{{0, time.Second}, {5, 0}} {
+		if ok, _, err := l.Allow(context.Background(), "k", c.limit, c.window); !ok || err != nil {
+			t.Errorf("Allow(limit=%d, window=%v) = %v, %v", c.limit, c.window, ok, err)
+		}
+	}
+	if ok, _, _, err := l.AllowAll(context.Background(), Window{Key: "k"}, Window{Key: "j", Limit: 1}); !ok || err != nil {
+		t.Errorf("AllowAll(disabled windows) = %v, %v", ok, err)
+	}
+}
+
+func TestAllowAllRecordsNothingWhenDenied(t *testing.T) {
+	l, key := newTestLimiter(t)
+	ctx := context.Background()
+	user, room, slow := key, key+":2", key+":3"
+	windows := []Window{
+		{Key: user, Limit: 5, Window: time.Second},
+		{Key: room, Limit: 5, Window: time.Second},
+		{Key: slow, Limit: 1, Window: 300 * time.Millisecond},
+	}
+
+	if ok, _, _, err := l.AllowAll(ctx, windows...); err != nil || !ok {
+		t.Fatalf("first event: ok=%v err=%v", ok, err)
+	}
+	for i := 0; i < 3; i++ {
+		ok, denied, retryAfter, err := l.AllowAll(ctx, windows...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok || denied != 2 {
+			t.Fatalf("event within the slow-mode interval: ok=%v denied=%d, want window 2", ok, denied)
+		}
+		if retryAfter <= 0 || retryAfter > 300*time.Millisecond {
+			t.Errorf("retryAfter = %v", retryAfter)
+		}
+	}
+	// The denied events used up neither the user's nor the room's window
+	for _, key := range []string{user, room, slow} {
+		if n := l.rdb.ZCard(ctx, key).Val(); n != 1 {
+			t.Errorf("%s holds %d entries, want 1", key, n)
+		}
+	}
+}
+
+func TestAllowAllReportsFullWindow(t *testing.T) {
+	l, key := newTestLimiter(t)
+	ctx := context.Background()
+	windows := []Window{
+		{Key: key, Limit: 2, Window: time.Second},
+		{Key: key + ":2"}, // disabled
+		{Key: key + ":3", Limit: 1, Window: time.Second},
+	}
+
+	if ok, _, _, _ := l.AllowAll(ctx, windows[0]); !ok {
+		t.Fatal("first event denied")
+	}
+	if ok, _, _, _ := l.AllowAll(ctx, windows[0]); !ok {
+		t.Fatal("second event denied")
+	}
+	ok, denied, _, err := l.AllowAll(ctx, windows...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || denied != 0 {
+		t.Fatalf("ok=%v denied=%d, want window 0", ok, denied)
+	}
+	if n := l.rdb.Exists(ctx, key+":3").Val(); n != 0 {
+		t.Error("a later window was recorded for a denied event")
+	}
+}
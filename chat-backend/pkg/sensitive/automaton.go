@@ -0,0 +1,100 @@
+package sensitive
+
+// automaton is an Aho-Corasick matcher over normalized runes.
+type automaton struct {
+	nodes    []acNode
+	patterns []pattern
+}
+
+type acNode struct {
+	next map[rune]int32
+	fail int32
+	out  []int32 // indices into patterns ending at this node
+}
+
+type pattern struct {
+	word   string // the list entry reported on a hit
+	length int    // length in normalized runes
+	list   int    // index of the owning list
+}
+
+type match struct {
+	start, end int // normalized rune range, end exclusive
+	pattern    int32
+}
+
+func newAutomaton() *automaton {
+	return &automaton{nodes: []acNode{{next: map[rune]int32{}}}}
+}
+
+func (a *automaton) add(key []rune, word string, list int) {
+	if len(key) == 0 {
+		return
+	}
+	cur := int32(0)
+	for _, r := range key {
+		nxt, ok := a.nodes[cur].next[r]
+		if !ok {
+			a.nodes = append(a.nodes, acNode{next: map[rune]int32{}})
+			nxt = int32(len(a.nodes) - 1)
+			a.nodes[cur].next[r] = nxt
+		}
+		cur = nxt
+	}
+	a.patterns = append(a.patterns, pattern{word: word, length: len(key), list: list})
+	a.nodes[cur].out = append(a.nodes[cur].out, int32(len(a.patterns)-1))
+}
+
+// build computes failure links breadth-first and merges output sets.
+func (a *automaton) build() {
+	queue := make([]int32, 0, len(a.nodes))
+	for _, child := range a.nodes[0].next {
+		a.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range a.nodes[cur].next {
+			f := a.nodes[cur].fail
+			for {
+				if nxt, ok := a.nodes[f].next[r]; ok && nxt != child {
+					a.nodes[child].fail = nxt
+					break
+				}
+				if f == 0 {
+					a.nodes[child].fail = 0
+					break
+				}
+				f = a.nodes[f].fail
+			}
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[a.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+func (a *automaton) find(text []rune) []match {
+	var matches []match
+	cur := int32(0)
+	for i, r := range text {
+		for {
+			if nxt, ok := a.nodes[cur].next[r]; ok {
+				cur = nxt
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = a.nodes[cur].fail
+		}
+		for _, p := range a.nodes[cur].out {
+			matches = append(matches, match{
+				start:   i - a.patterns[p].length + 1,
+				end:     i + 1,
+				pattern: p,
+			})
+		}
+	}
+	return matches
+}
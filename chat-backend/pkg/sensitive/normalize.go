@@ -0,0 +1,160 @@
+package sensitive
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// normalized is a folded view of a text. pos maps every normalized rune back
+// to the index of the original rune it came from, so that matches can be
+// masked in the original text.
+type normalized struct {
+	runes []rune
+	pos   []int
+}
+
+// foldRune maps full-width forms to their narrow equivalents and lowercases.
+// It reports false for runes that are dropped before matching: whitespace,
+// punctuation, symbols and zero-width characters that are commonly inserted
+// to split a word ("敏 感", "敏*感", "敏​感").
+func foldRune(r rune) (rune, bool) {
+	if f := width.LookupRune(r).Folded(); f != 0 {
+		r = f
+	}
+	if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		return 0, false
+	}
+	return unicode.ToLower(r), true
+}
+
+func normalize(text []rune) normalized {
+	n := normalized{
+		runes: make([]rune, 0, len(text)),
+		pos:   make([]int, 0, len(text)),
+	}
+	for i, r := range text {
+		if f, ok := foldRune(r); ok {
+			n.runes = append(n.runes, f)
+			n.pos = append(n.pos, i)
+		}
+	}
+	return n
+}
+
+// transliterate replaces every Han character that has a pinyin reading with
+// its toneless syllable, so that "法lun功", "fa轮gong" and "falungong" all
+// produce the same stream.
+func (n normalized) transliterate(table pinyinTable) normalized {
+	out := normalized{
+		runes: make([]rune, 0, len(n.runes)*2),
+		pos:   make([]int, 0, len(n.runes)*2),
+	}
+	for i, r := range n.runes {
+		if py, ok := table[r]; ok {
+			for _, p := range py {
+				out.runes = append(out.runes, p)
+				out.pos = append(out.pos, n.pos[i])
+			}
+			continue
+		}
+		out.runes = append(out.runes, r)
+		out.pos = append(out.pos, n.pos[i])
+	}
+	return out
+}
+
+func normalizeKey(word string) []rune {
+	return normalize([]rune(word)).runes
+}
+
+// pinyinTable maps a Han character to its first toneless pinyin reading.
+type pinyinTable map[rune]string
+
+var toneMarks = strings.NewReplacer(
+	"ā", "a", "á", "a", "ǎ", "a", "à", "a",
+	"ē", "e", "é", "e", "ě", "e", "è", "e",
+	"ī", "i", "í", "i", "ǐ", "i", "ì", "i",
+	"ō", "o", "ó", "o", "ǒ", "o", "ò", "o",
+	"ū", "u", "ú", "u", "ǔ", "u", "ù", "u",
+	"ǖ", "v", "ǘ", "v", "ǚ", "v", "ǜ", "v", "ü", "v",
+	"ń", "n", "ň", "n", "ǹ", "n", "ḿ", "m",
+)
+
+// loadPinyinTable reads either "中 zhong" lines or the pinyin-data format
+// "U+4E2D: zhōng,zhòng  # 中". Only the first reading of a character is kept.
+func loadPinyinTable(filename string) (pinyinTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table := make(pinyinTable)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var char rune
+		var readings string
+		if strings.HasPrefix(line, "U+") {
+			code, rest, ok := strings.Cut(line[2:], ":")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseInt(code, 16, 32)
+			if err != nil {
+				continue
+			}
+			char, readings = rune(v), rest
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			r := []rune(fields[0])
+			if len(r) != 1 {
+				continue
+			}
+			char, readings = r[0], fields[1]
+		}
+
+		first, _, _ := strings.Cut(strings.TrimSpace(readings), ",")
+		first = toneMarks.Replace(strings.ToLower(strings.TrimSpace(first)))
+		first = strings.TrimRight(first, "12345") // numbered tones
+		if first != "" {
+			table[char] = first
+		}
+	}
+	return table, scanner.Err()
+}
+
+// toPinyin converts a word to its pinyin key, or "" if it contains no Han
+// character with a known reading.
+func (t pinyinTable) toPinyin(word string) string {
+	var b strings.Builder
+	converted := false
+	for _, r := range word {
+		if py, ok := t[r]; ok {
+			b.WriteString(py)
+			converted = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if !converted {
+		return ""
+	}
+	return b.String()
+}
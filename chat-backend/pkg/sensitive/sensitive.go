@@ -0,0 +1,261 @@
+// Package sensitive implements configurable sensitive-word filtering.
+//
+// Each word list is loaded from a text file with one entry per line. An entry
+// may list variants after the word, separated by "|" ("word|variant|..."),
+// which are reported as the word itself. Lines starting with "#" are comments.
+// Text and entries are normalized before matching (full-width folding, case
+// folding, separators dropped). When a pinyin table is configured, Chinese
+// entries also match their toneless pinyin spelling, including mixed forms.
+package sensitive
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionBlock  Action = "block"
+	ActionMask   Action = "mask"
+	ActionReview Action = "review"
+)
+
+type ListConfig struct {
+	Name   string `mapstructure:"name"`
+	File   string `mapstructure:"file"`
+	Action Action `mapstructure:"action"`
+}
+
+type Config struct {
+	Lists       []ListConfig `mapstructure:"lists"`
+	PinyinTable string       `mapstructure:"pinyin_table"`
+}
+
+type Hit struct {
+	List   string `json:"list"`
+	Action Action `json:"action"`
+	Word   string `json:"word"`
+}
+
+type Result struct {
+	Text    string // input with every mask hit replaced by '*'
+	Blocked bool
+	Flagged bool
+	Hits    []Hit
+}
+
+type Filter struct {
+	cfg    Config
+	state  atomic.Pointer[state]
+	mu     sync.Mutex
+	mtimes map[string]time.Time
+}
+
+type state struct {
+	lists    []ListConfig
+	ac       *automaton
+	pinyin   pinyinTable
+	pinyinAC *automaton
+}
+
+// New loads every configured list. A Filter without lists lets all text pass.
+func New(cfg Config) (*Filter, error) {
+	for _, l := range cfg.Lists {
+		switch l.Action {
+		case ActionBlock, ActionMask, ActionReview:
+		default:
+			return nil, fmt.Errorf("sensitive: list %q has unknown action %q", l.Name, l.Action)
+		}
+	}
+	f := &Filter{cfg: cfg, mtimes: make(map[string]time.Time)}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload rebuilds the matcher from disk. On error the previous lists stay
+// in effect.
+func (f *Filter) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+func (f *Filter) reload() error {
+	st := &state{lists: f.cfg.Lists, ac: newAutomaton()}
+	mtimes := make(map[string]time.Time)
+
+	if f.cfg.PinyinTable != "" {
+		table, err := loadPinyinTable(f.cfg.PinyinTable)
+		if err != nil {
+			return fmt.Errorf("sensitive: load pinyin table: %w", err)
+		}
+		st.pinyin = table
+		st.pinyinAC = newAutomaton()
+		if info, err := os.Stat(f.cfg.PinyinTable); err == nil {
+			mtimes[f.cfg.PinyinTable] = info.ModTime()
+		}
+	}
+
+	for i, l := range f.cfg.Lists {
+		info, err := os.Stat(l.File)
+		if err != nil {
+			return fmt.Errorf("sensitive: list %q: %w", l.Name, err)
+		}
+		mtimes[l.File] = info.ModTime()
+
+		entries, err := readList(l.File)
+		if err != nil {
+			return fmt.Errorf("sensitive: list %q: %w", l.Name, err)
+		}
+		for _, variants := range entries {
+			word := variants[0]
+			for _, v := range variants {
+				st.ac.add(normalizeKey(v), word, i)
+				if st.pinyin != nil {
+					if py := st.pinyin.toPinyin(v); py != "" {
+						st.pinyinAC.add(normalizeKey(py), word, i)
+					}
+				}
+			}
+		}
+	}
+
+	st.ac.build()
+	if st.pinyinAC != nil {
+		st.pinyinAC.build()
+	}
+	f.state.Store(st)
+	f.mtimes = mtimes
+	return nil
+}
+
+// Watch polls the list files every interval and reloads them when one has
+// changed. It returns when stop is closed.
+func (f *Filter) Watch(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (f *Filter) changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files := make([]string, 0, len(f.cfg.Lists)+1)
+	for _, l := range f.cfg.Lists {
+		files = append(files, l.File)
+	}
+	if f.cfg.PinyinTable != "" {
+		files = append(files, f.cfg.PinyinTable)
+	}
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil || !info.ModTime().Equal(f.mtimes[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs text through every list.
+func (f *Filter) Check(text string) Result {
+	result := Result{Text: text}
+	if f == nil {
+		return result
+	}
+	st := f.state.Load()
+	if st == nil || len(st.ac.patterns) == 0 {
+		return result
+	}
+
+	runes := []rune(text)
+	norm := normalize(runes)
+	mask := make([]bool, len(runes))
+	seen := make(map[Hit]bool)
+
+	apply := func(ac *automaton, stream normalized) {
+		for _, m := range ac.find(stream.runes) {
+			p := ac.patterns[m.pattern]
+			l := st.lists[p.list]
+			hit := Hit{List: l.Name, Action: l.Action, Word: p.word}
+			if !seen[hit] {
+				seen[hit] = true
+				result.Hits = append(result.Hits, hit)
+			}
+			switch l.Action {
+			case ActionBlock:
+				result.Blocked = true
+			case ActionReview:
+				result.Flagged = true
+			case ActionMask:
+				for i := stream.pos[m.start]; i <= stream.pos[m.end-1]; i++ {
+					mask[i] = true
+				}
+			}
+		}
+	}
+
+	apply(st.ac, norm)
+	if st.pinyinAC != nil {
+		apply(st.pinyinAC, norm.transliterate(st.pinyin))
+	}
+
+	masked := false
+	for i := range runes {
+		if mask[i] {
+			runes[i] = '*'
+			masked = true
+		}
+	}
+	if masked {
+		result.Text = string(runes)
+	}
+	return result
+}
+
+func readList(filename string) ([][]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var variants []string
+		for _, v := range strings.Split(line, "|") {
+			if v = strings.TrimSpace(v); v != "" {
+				variants = append(variants, v)
+			}
+		}
+		if len(variants) > 0 {
+			entries = append(entries, variants)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,201 @@
+package sensitive
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestFilter(t *testing.T, pinyin string) *Filter {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := Config{
+		Lists: []ListConfig{
+			{Name: "blocked", File: writeFile(t, dir, "block.txt", "# comment\nforbidden\n敏感|mg\n"), Action: ActionBlock},
+			{Name: "masked", File: writeFile(t, dir, "mask.txt", "bad|b4d\ndamn\n"), Action: ActionMask},
+			{Name: "review", File: writeFile(t, dir, "review.txt", "suspicious\n"), Action: ActionReview},
+		},
+	}
+	if pinyin != "" {
+		cfg.PinyinTable = writeFile(t, dir, "pinyin.txt", pinyin)
+	}
+	f, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestAutomatonOverlappingMatches(t *testing.T) {
+	ac := newAutomaton()
+	for i, w := range []string{"he", "she", "his", "hers"} {
+		ac.add([]rune(w), w, i)
+	}
+	ac.build()
+
+	var got []string
+	for _, m := range ac.find([]rune("ushers")) {
+		got = append(got, ac.patterns[m.pattern].word)
+		if want := ac.patterns[m.pattern].length; m.end-m.start != want {
+			t.Errorf("match %q spans %d runes, want %d", ac.patterns[m.pattern].word, m.end-m.start, want)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"he", "hers", "she"}
+	if len(got) != len(want) {
+		t.Fatalf("find(ushers) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("find(ushers) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	f := newTestFilter(t, "")
+
+	tests := []struct {
+		name    string
+		text    string
+		blocked bool
+		flagged bool
+		masked  string
+	}{
+		{name: "clean", text: "hello there", masked: "hello there"},
+		{name: "block", text: "this is forbidden", blocked: true, masked: "this is forbidden"},
+		{name: "review", text: "very suspicious", flagged: true, masked: "very suspicious"},
+		{name: "mask", text: "a bad day", masked: "a *** day"},
+		{name: "mask several", text: "damn, bad", masked: "****, ***"},
+		{name: "variant", text: "so b4d", masked: "so ***"},
+		{name: "full-width", text: "ｆｏｒｂｉｄｄｅｎ", blocked: true, masked: "ｆｏｒｂｉｄｄｅｎ"},
+		{name: "full-width mask", text: "ＢＡＤ!", masked: "***!"},
+		{name: "case folded", text: "ForBidden", blocked: true, masked: "ForBidden"},
+		{name: "separators", text: "b.a d", masked: "*****"},
+		{name: "zero-width split", text: "敏​感", blocked: true, masked: "敏​感"},
+		{name: "han with spaces", text: "敏 感", blocked: true, masked: "敏 感"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := f.Check(tt.text)
+			if r.Blocked != tt.blocked || r.Flagged != tt.flagged {
+				t.Errorf("Check(%q) blocked=%v flagged=%v, want %v %v", tt.text, r.Blocked, r.Flagged, tt.blocked, tt.flagged)
+			}
+			if r.Text != tt.masked {
+				t.Errorf("Check(%q).Text = %q, want %q", tt.text, r.Text, tt.masked)
+			}
+		})
+	}
+}
+
+func TestCheckReportsEntryWord(t *testing.T) {
+	f := newTestFilter(t, "")
+	r := f.Check("b4d and bad")
+	if len(r.Hits) != 1 {
+		t.Fatalf("hits = %+v, want one deduplicated hit", r.Hits)
+	}
+	want := Hit{List: "masked", Action: ActionMask, Word: "bad"}
+	if r.Hits[0] != want {
+		t.Errorf("hit = %+v, want %+v", r.Hits[0], want)
+	}
+}
+
+func TestCheckPinyin(t *testing.T) {
+	f := newTestFilter(t, "敏 min3\nU+611F: gǎn  # 感\n")
+	for _, text := range []string{"mingan", "敏gan", "min感", "MIN GAN"} {
+		if r := f.Check(text); !r.Blocked {
+			t.Errorf("Check(%q) not blocked", text)
+		}
+	}
+	if r := f.Check("mingle"); r.Blocked {
+		t.Errorf("Check(mingle) blocked")
+	}
+}
+
+func TestNilAndEmptyFilter(t *testing.T) {
+	var f *Filter
+	if r := f.Check("forbidden"); r.Blocked || r.Text != "forbidden" {
+		t.Errorf("nil filter Check = %+v", r)
+	}
+	empty, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := empty.Check("forbidden"); r.Blocked {
+		t.Errorf("empty filter blocked text")
+	}
+}
+
+func TestNewRejectsUnknownAction(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(Config{Lists: []ListConfig{
+		{Name: "x", File: writeFile(t, dir, "x.txt", "x\n"), Action: "drop"},
+	}})
+	if err == nil {
+		t.Fatal("New accepted an unknown action")
+	}
+}
+
+func TestReloadKeepsListsOnError(t *testing.T) {
+	f := newTestFilter(t, "")
+	if err := os.Remove(f.cfg.Lists[0].File); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload(); err == nil {
+		t.Fatal("Reload succeeded with a missing list")
+	}
+	if r := f.Check("forbidden"); !r.Blocked {
+		t.Error("previous lists dropped after a failed reload")
+	}
+}
+
+func TestWatchReloadsAndStops(t *testing.T) {
+	f := newTestFilter(t, "")
+	file := f.cfg.Lists[0].File
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		f.Watch(10*time.Millisecond, stop, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	if err := os.WriteFile(file, []byte("newword\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Make the change visible on filesystems with coarse mtimes
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for !f.Check("newword").Blocked {
+		select {
+		case <-deadline:
+			t.Fatal("list change not picked up")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if f.Check("forbidden").Blocked {
+		t.Error("removed entry still blocked after reload")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after stop was closed")
+	}
+}
@@ -47,6 +47,31 @@ func Error(c *gin.Context, httpStatus int, err error) {
 	})
 }
 
+// StatusFromError 根据业务错误码选择 HTTP 状态码，无法识别时使用 fallback
+func StatusFromError(err error, fallback int) int {
+	var xerr *xerror.Error
+	if !errors.As(err, &xerr) {
+		return fallback
+	}
+	switch xerr.Code {
+	case xerror.CodeInvalidParams, xerror.CodeContentBlocked:
+		return http.StatusBadRequest
+	case xerror.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case xerror.CodePermissionDenied, xerror.CodeMuted:
+		return http.StatusForbidden
+	case xerror.CodeNotFound:
+		return http.StatusNotFound
+	case xerror.CodeAlreadyExists, xerror.CodeRoomFull:
+		return http.StatusConflict
+	case xerror.CodeRateLimited:
+		return http.StatusTooManyRequests
+	case xerror.CodeExpired:
+		return http.StatusGone
+	}
+	return fallback
+}
+
 // ErrorWithCode 带自定义状态码的错误响应
 func ErrorWithCode(c *gin.Context, httpStatus int, code xerror.Code, message string) {
 	c.JSON(httpStatus, Response{
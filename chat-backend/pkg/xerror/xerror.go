@@ -5,18 +5,24 @@ import "fmt"
 type Code uint32
 
 const (
-	CodeOK             Code = 0
-	CodeInternalError  Code = 10001
-	CodeInvalidParams  Code = 10002
-	CodeUnauthorized   Code = 10003
-	CodeNotFound       Code = 10004
-	CodeAlreadyExists  Code = 10005
+	CodeOK               Code = 0
+	CodeInternalError    Code = 10001
+	CodeInvalidParams    Code = 10002
+	CodeUnauthorized     Code = 10003
+	CodeNotFound         Code = 10004
+	CodeAlreadyExists    Code = 10005
 	CodePermissionDenied Code = 10006
+	CodeContentBlocked   Code = 10007
+	CodeRateLimited      Code = 10008
+	CodeExpired          Code = 10009
+	CodeMuted            Code = 10010
+	CodeRoomFull         Code = 10011
 )
 
 type Error struct {
-	Code    Code   `json:"code"`
-	Message string `json:"message"`
+	Code    Code                   `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 func (e *Error) Error() string {
@@ -29,3 +35,12 @@ func New(code Code, message string) *Error {
 		Message: message,
 	}
 }
+
+// WithDetail attaches machine-readable context such as "retry_after_ms".
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}